@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/autoqr"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/config"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/input"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/server"
+)
+
+// controller holds the runtime switches changed through POST /control: pause/resume,
+// forced polls, autoqr_mode, debug logging and openid renewal. The poll loop reads it every round.
+type controller struct {
+	logs      *logging.Manager
+	status    func() any
+	checkMode func(mode string) error   // 切换前校验后端是否可用；nil 时只检查是否已注册
+	renew     func(openid string) error // 校验并换用新的 openid，一般为 session.Renew
+
+	mu        sync.Mutex
+	baseLevel slog.Level // 关闭 debug 时恢复的默认级别
+	paused    bool
+	resumed   chan struct{} // 暂停期间有效；恢复时关闭
+	mode      string
+	wake      chan struct{} // 容量 1：立即轮询一次
+}
+
+func newController(logs *logging.Manager, mode string) *controller {
+	c := &controller{logs: logs, mode: mode, wake: make(chan struct{}, 1)}
+	c.setBaseLevel(logs.Level(""))
+	return c
+}
+
+// Mode is the current autoqr_mode.
+func (c *controller) Mode() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mode
+}
+
+// setMode changes autoqr_mode, e.g. after a config reload.
+func (c *controller) setMode(mode string) {
+	c.mu.Lock()
+	c.mode = mode
+	c.mu.Unlock()
+}
+
+// setBaseLevel records the configured default level that "debug off" returns to.
+func (c *controller) setBaseLevel(lvl slog.Level) {
+	if lvl == slog.LevelDebug {
+		lvl = slog.LevelInfo
+	}
+	c.mu.Lock()
+	c.baseLevel = lvl
+	c.mu.Unlock()
+}
+
+func (c *controller) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+func (c *controller) Debug() bool {
+	return c.logs.Level("") <= slog.LevelDebug
+}
+
+// waitWhilePaused blocks until resumed; a forced poll lets one round through.
+func (c *controller) waitWhilePaused() {
+	c.mu.Lock()
+	ch := c.resumed
+	c.mu.Unlock()
+	if ch == nil {
+		return
+	}
+	select {
+	case <-ch:
+	case <-c.wake:
+	}
+}
+
+// sleep waits for the polling interval or until a poll is forced.
+func (c *controller) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-c.wake:
+	}
+}
+
+// woken fires when a poll is forced, for waits that select on other channels too.
+func (c *controller) woken() <-chan struct{} {
+	return c.wake
+}
+
+// Execute runs one control command; it is the server.ControlFunc.
+func (c *controller) Execute(req server.ControlRequest) (any, error) {
+	switch req.Command {
+	case "pause":
+		c.mu.Lock()
+		if !c.paused {
+			c.paused = true
+			c.resumed = make(chan struct{})
+		}
+		c.mu.Unlock()
+		log.Info("[Control] 轮询已暂停")
+		return map[string]any{"paused": true}, nil
+	case "resume":
+		c.mu.Lock()
+		if c.paused {
+			c.paused = false
+			close(c.resumed)
+			c.resumed = nil
+		}
+		c.mu.Unlock()
+		log.Info("[Control] 轮询已恢复")
+		return map[string]any{"paused": false}, nil
+	case "poll":
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+		log.Info("[Control] 立即轮询")
+		return map[string]any{"poll": "scheduled"}, nil
+	case "mode":
+		mode := strings.ToLower(strings.TrimSpace(req.Arg))
+		check := c.checkMode
+		if check == nil {
+			check = autoqr.Check
+		}
+		if err := check(mode); err != nil {
+			return nil, err
+		}
+		c.setMode(mode)
+		log.Info("[Control] autoqr_mode 已切换", "mode", mode)
+		return map[string]any{"autoqr_mode": mode}, nil
+	case "debug":
+		on := !c.Debug()
+		switch strings.ToLower(req.Arg) {
+		case "":
+		case "on", "1", "true":
+			on = true
+		case "off", "0", "false":
+			on = false
+		default:
+			return nil, fmt.Errorf("debug expects on or off, got %q", req.Arg)
+		}
+		if on {
+			c.logs.SetLevel("", slog.LevelDebug)
+		} else {
+			c.mu.Lock()
+			base := c.baseLevel
+			c.mu.Unlock()
+			c.logs.SetLevel("", base)
+		}
+		log.Info("[Control] debug 日志", "on", on)
+		return map[string]any{"debug": on}, nil
+	case "openid":
+		if c.renew == nil {
+			return nil, errors.New("openid renewal unavailable")
+		}
+		// 与标准输入相同，接受 openid 本身或含 openid 的链接；WS 连接不受影响
+		id, err := input.ExtractOpenid(req.Arg)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.renew(id); err != nil {
+			return nil, fmt.Errorf("openid rejected: %w", err)
+		}
+		log.Info("[Control] openid 已更新")
+		return map[string]any{"renewed": true}, nil
+	case "status":
+		if c.status == nil {
+			return nil, errors.New("status unavailable")
+		}
+		return c.status(), nil
+	default:
+		return nil, fmt.Errorf("unknown command %q (pause, resume, poll, mode, debug, openid, status)", req.Command)
+	}
+}
+
+// runCtl is the ctl subcommand: it sends one command to a running instance.
+func runCtl(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	addr := fs.String("addr", "", "实例的 http_addr（默认读取配置文件）")
+	token := fs.String("token", "", "control_token（默认读取配置文件或环境变量 WZJ_CONTROL_TOKEN）")
+	cfgPath := fs.String("config", "", "读取 http_addr/control_token 的配置文件，默认与主程序相同（WZJ_CONFIG 或依次查找 config.json/.yaml/.yml/.toml）")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wzj-assistant-autoCkeckin ctl [--config file] [--addr host:port] [--token t] <pause|resume|poll|mode <manual|autohotkey|exec>|debug [on|off]|openid <openid|url>|status>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	if *addr == "" || *token == "" {
+		cfg, err := (&config.Loader{Path: configPath(*cfgPath), Env: os.Environ()}).Load()
+		switch {
+		case err == nil:
+			if *addr == "" {
+				*addr = cfg.HTTPAddr
+			}
+			if *token == "" {
+				*token = controlToken(cfg)
+			}
+		case *cfgPath != "":
+			// 显式指定的配置文件读不了时直接报错，不再静默回退
+			fmt.Fprintln(os.Stderr, "ctl:", err)
+			return 2
+		}
+	}
+	if *token == "" {
+		*token = os.Getenv("WZJ_CONTROL_TOKEN")
+	}
+	if *addr == "" {
+		fmt.Fprintln(os.Stderr, "ctl: 未配置 http_addr，请在配置文件中设置或使用 --addr / --config")
+		return 2
+	}
+	req := server.ControlRequest{Command: fs.Arg(0), Arg: fs.Arg(1)}
+	resp, err := server.Control(*addr, *token, req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ctl:", err)
+		return 1
+	}
+	if !resp.OK {
+		fmt.Fprintln(os.Stderr, "ctl:", resp.Error)
+		return 1
+	}
+	out, _ := json.MarshalIndent(resp.Result, "", "  ")
+	fmt.Println(string(out))
+	return 0
+}
+
+// controlToken is control_token from config, else WZJ_CONTROL_TOKEN.
+func controlToken(cfg *config.Config) string {
+	if cfg.ControlToken != "" {
+		return cfg.ControlToken
+	}
+	return os.Getenv("WZJ_CONTROL_TOKEN")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/requests"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/server"
+)
+
+const (
+	oldOpenID = "0123456789abcdef0123456789abcdef"
+	newOpenID = "fedcba9876543210fedcba9876543210"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// studentsStub accepts only newOpenID on v2/students.
+func studentsStub() *requests.Client {
+	return requests.NewWithTransport("test-agent", roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		status, body := http.StatusUnauthorized, `{"message":"unauthorized"}`
+		if req.Header.Get("openId") == newOpenID {
+			status, body = http.StatusOK, `[[{"item_name":"name","item_value":"测试同学"},{"item_name":"student_number","item_value":"20260001"}]]`
+		}
+		return &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}))
+}
+
+func TestControlOpenIDRenewsExpiredSession(t *testing.T) {
+	logs, err := logging.New(logging.Options{Level: "error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// markExpired 会打印错误日志并提示输入，测试中不需要这些输出
+	old := log
+	log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	defer func() { log = old }()
+
+	bus := events.NewBus()
+	sub, unsubscribe := bus.Subscribe(8)
+	defer unsubscribe()
+	sess := newSession(studentsStub(), nil, bus, oldOpenID, &requests.StudentProfile{Name: "测试同学"})
+	ctl := newController(logs, "manual")
+	ctl.renew = sess.Renew
+
+	sess.markExpired(errors.New("401"))
+	renewed := make(chan struct{})
+	go func() {
+		sess.waitRenewed()
+		close(renewed)
+	}()
+
+	// 无效的输入与被服务器拒绝的 openid 都不应恢复会话
+	if _, err := ctl.Execute(server.ControlRequest{Command: "openid", Arg: "not an openid"}); err == nil {
+		t.Fatal("garbage accepted as openid")
+	}
+	if _, err := ctl.Execute(server.ControlRequest{Command: "openid", Arg: oldOpenID}); err == nil {
+		t.Fatal("rejected openid accepted")
+	}
+	if !sess.Expired() {
+		t.Fatal("session resumed with a rejected openid")
+	}
+
+	// 与控制台输入一样，可以直接粘贴链接
+	link := "https://v18.teachermate.cn/wechat-pro-ssr/student/sign?openid=" + newOpenID
+	if _, err := ctl.Execute(server.ControlRequest{Command: "openid", Arg: link}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-renewed:
+	case <-time.After(time.Second):
+		t.Fatal("poll loop still waiting after openid renewal")
+	}
+	if sess.Expired() || sess.OpenID() != newOpenID {
+		t.Fatalf("session = expired %v, openid %q", sess.Expired(), sess.OpenID())
+	}
+	var kinds []string
+	for len(sub) > 0 {
+		kinds = append(kinds, (<-sub).Kind)
+	}
+	if strings.Join(kinds, ",") != events.OpenIDExpired+","+events.OpenIDRenewed {
+		t.Fatalf("events = %v", kinds)
+	}
+}
+
+func TestControlOpenIDUnavailable(t *testing.T) {
+	logs, err := logging.New(logging.Options{Level: "error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newController(logs, "manual").Execute(server.ControlRequest{Command: "openid", Arg: newOpenID}); err == nil {
+		t.Fatal("openid command succeeded without a session")
+	}
+}
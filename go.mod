@@ -3,13 +3,11 @@ module github.com/zwh20041221/wzj-assistant-autoCkeckin
 go 1.25.3
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/gorilla/websocket v1.5.3
-	github.com/mdp/qrterminal/v3 v3.2.1
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/term v0.13.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	golang.org/x/sys v0.29.0 // indirect
-	golang.org/x/term v0.13.0 // indirect
-	rsc.io/qr v0.2.0 // indirect
-)
+require golang.org/x/sys v0.29.0 // indirect
@@ -0,0 +1,135 @@
+package autoqr
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// AutoHotkey dialects; VersionAuto picks one from the interpreter that was found.
+const (
+	VersionAuto = "auto"
+	VersionV1   = "v1"
+	VersionV2   = "v2"
+)
+
+//go:embed scripts/*.ahk.tmpl
+var scriptFS embed.FS
+
+var scripts = template.Must(template.New("ahk").Option("missingkey=error").Funcs(template.FuncMap{
+	"ahkv1": quoteV1,
+	"ahkv2": quoteV2,
+}).ParseFS(scriptFS, "scripts/*.ahk.tmpl"))
+
+// ScriptParams fills the WeChat screenshot script templates.
+type ScriptParams struct {
+	Image      string // 二维码图片路径
+	X, Y       int    // 图片窗口左上角（屏幕像素）
+	Size       int    // 图片边长
+	RecognizeX int    // 识别按钮绝对坐标，0 表示不点击
+	RecognizeY int
+}
+
+// RenderScript generates the WeChat screenshot script for an AutoHotkey dialect (v1 or v2).
+func RenderScript(version string, p ScriptParams) ([]byte, error) {
+	if p.Size <= 0 {
+		p.Size = 300
+	}
+	var name string
+	switch version {
+	case VersionV1:
+		name = "wechat_v1.ahk.tmpl"
+	case VersionV2:
+		name = "wechat_v2.ahk.tmpl"
+	default:
+		return nil, fmt.Errorf("unknown AutoHotkey version %q (v1, v2)", version)
+	}
+	var b bytes.Buffer
+	if err := scripts.ExecuteTemplate(&b, name, p); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// CheckVersion validates an autoqr_ahk_version value.
+func CheckVersion(v string) error {
+	switch v {
+	case VersionAuto, VersionV1, VersionV2:
+		return nil
+	}
+	return fmt.Errorf("autoqr_ahk_version must be auto, v1 or v2, got %q", v)
+}
+
+// quoteV1 escapes s for a v1 expression string: quotes are doubled, ` is the escape char.
+func quoteV1(s string) string {
+	return strings.NewReplacer("`", "``", `"`, `""`).Replace(s)
+}
+
+// quoteV2 escapes s for a v2 string literal, where ` escapes both itself and quotes.
+func quoteV2(s string) string {
+	return strings.NewReplacer("`", "``", `"`, "`\"").Replace(s)
+}
+
+// detectVersion guesses the dialect from the interpreter path: v2 installs under ...\v2\
+// and names its binaries AutoHotkey64/32.exe, v1.1 uses AutoHotkeyU64/U32/A32.exe.
+func detectVersion(exe string) string {
+	p := strings.ToLower(strings.ReplaceAll(exe, `\`, "/"))
+	if strings.Contains(p, "/v2") {
+		return VersionV2
+	}
+	switch filepath.Base(p) {
+	case "autohotkey64.exe", "autohotkey32.exe":
+		return VersionV2
+	}
+	return VersionV1
+}
+
+// findAutoHotkey locates an interpreter for the wanted dialect (auto: the first found).
+// AUTOHOTKEY_EXE always wins; with a forced version it is trusted to run that dialect.
+func findAutoHotkey(want string) (exe, version string, err error) {
+	if p := os.Getenv("AUTOHOTKEY_EXE"); p != "" {
+		if _, err := os.Stat(p); err == nil {
+			if want == VersionV1 || want == VersionV2 {
+				return p, want, nil
+			}
+			return p, detectVersion(p), nil
+		}
+	}
+	var candidates []string
+	for _, name := range []string{"AutoHotkey64.exe", "AutoHotkeyU64.exe", "AutoHotkey.exe", "AutoHotkey32.exe"} {
+		if p, err := exec.LookPath(name); err == nil {
+			candidates = append(candidates, p)
+		}
+	}
+	// Typical install dirs；v2 安装程序把 v1 放在 v1.1.x 子目录
+	candidates = append(candidates,
+		`C:\Program Files\AutoHotkey\v2\AutoHotkey64.exe`,
+		`C:\Program Files\AutoHotkey\AutoHotkeyU64.exe`,
+		`C:\Program Files\AutoHotkey\AutoHotkey.exe`,
+		`C:\Program Files (x86)\AutoHotkey\AutoHotkey.exe`,
+	)
+	if m, _ := filepath.Glob(`C:\Program Files\AutoHotkey\v1*\AutoHotkeyU64.exe`); len(m) > 0 {
+		candidates = append(candidates, m...)
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err != nil {
+			continue
+		}
+		v := detectVersion(c)
+		if want == VersionV1 || want == VersionV2 {
+			if v != want {
+				continue
+			}
+		}
+		return c, v, nil
+	}
+	if want == VersionV1 || want == VersionV2 {
+		return "", "", fmt.Errorf("%w（需要 %s）", ErrNotInstalled, want)
+	}
+	return "", "", ErrNotInstalled
+}
@@ -0,0 +1,53 @@
+package autoqr
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden from the current templates")
+
+// goldenParams uses a path with spaces, backslashes, a backtick and a quote, so escaping
+// changes in either dialect show up in the diff.
+var goldenParams = ScriptParams{
+	Image:      `C:\Users\Zhang San\AppData\Local\Temp\wzj-autoqr\run-42-x\qr "latest" ` + "`1`" + `.png`,
+	X:          120,
+	Y:          80,
+	Size:       360,
+	RecognizeX: 1500,
+	RecognizeY: 900,
+}
+
+func TestRenderScriptGolden(t *testing.T) {
+	for _, version := range []string{VersionV1, VersionV2} {
+		t.Run(version, func(t *testing.T) {
+			got, err := RenderScript(version, goldenParams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", "wechat_"+version+".golden")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run go test ./internal/autoqr -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s script differs from %s; if the change is intended, run go test ./internal/autoqr -update\n--- got ---\n%s", version, path, got)
+			}
+		})
+	}
+}
+
+func TestRenderScriptUnknownVersion(t *testing.T) {
+	if _, err := RenderScript("v3", goldenParams); err == nil {
+		t.Fatal("want error for unknown version")
+	}
+}
@@ -1,131 +1,149 @@
 package autoqr
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"time"
 
-	qrcode "github.com/skip2/go-qrcode"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qr"
 )
 
+var log = logging.Discard()
+
+// SetLogger injects the logger used by the package.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = logging.Discard()
+	}
+	log = l
+}
+
 // GenerateQRPng creates a PNG file for the given url and returns its path.
 func GenerateQRPng(url string, size int) (string, error) {
 	if size <= 0 {
 		size = 300
 	}
-	dir := os.TempDir()
-	name := fmt.Sprintf("wzj_autoqr_%d.png", time.Now().UnixNano())
-	out := filepath.Join(dir, name)
-	if err := qrcode.WriteFile(url, qrcode.Medium, size, out); err != nil {
+	out := artifactPath(fmt.Sprintf("wzj_autoqr_%d.png", time.Now().UnixNano()))
+	data, err := qr.PNG(url, "M", size)
+	if err != nil {
+		return "", err
+	}
+	if err := qr.WriteFileAtomic(out, data); err != nil {
 		return "", err
 	}
+	log.Debug("qr png written", "path", out, "size", size)
 	return out, nil
 }
 
-func findAutoHotkey() (string, error) {
-	// Allow override
-	if p := os.Getenv("AUTOHOTKEY_EXE"); p != "" {
-		if _, err := os.Stat(p); err == nil {
-			return p, nil
-		}
-	}
-	// PATH
-	if p, err := exec.LookPath("AutoHotkey64.exe"); err == nil {
-		return p, nil
-	}
-	if p, err := exec.LookPath("AutoHotkey.exe"); err == nil {
-		return p, nil
-	}
-	// Typical install dirs
-	candidates := []string{
-		`C:\\Program Files\\AutoHotkey\\AutoHotkey64.exe`,
-		`C:\\Program Files\\AutoHotkey\\AutoHotkey.exe`,
-		`C:\\Program Files (x86)\\AutoHotkey\\AutoHotkey.exe`,
+// ErrNotInstalled means no AutoHotkey interpreter was found; retrying cannot help.
+var ErrNotInstalled = errors.New("AutoHotkey 未找到，请安装或设置环境变量 AUTOHOTKEY_EXE")
+
+// ScriptRun describes one finished AutoHotkey run.
+type ScriptRun struct {
+	Exe      string
+	Version  string
+	Steps    []string // 脚本通过 stdout 报告的已完成步骤（step:<名称>），完整执行以 done 结尾
+	ExitCode int      // -1 表示未正常退出（超时被终止等）
+	Stdout   string   // 除 step 行之外的输出
+	Stderr   string   // /ErrorStdOut 输出的脚本错误
+	Duration time.Duration
+}
+
+// Done reports whether the script ran to its last step.
+func (r ScriptRun) Done() bool {
+	return len(r.Steps) > 0 && r.Steps[len(r.Steps)-1] == "done"
+}
+
+// ScriptError is a run that timed out, exited non-zero or stopped before its last step.
+type ScriptError struct {
+	Run ScriptRun
+	Err error
+}
+
+func (e *ScriptError) Error() string {
+	msg := fmt.Sprintf("autohotkey 脚本失败: %v (exit=%d, steps=%s)", e.Err, e.Run.ExitCode, strings.Join(e.Run.Steps, ","))
+	if e.Run.Stderr != "" {
+		msg += ": " + e.Run.Stderr
 	}
-	for _, c := range candidates {
-		if _, err := os.Stat(c); err == nil {
-			return c, nil
-		}
+	return msg
+}
+
+func (e *ScriptError) Unwrap() error { return e.Err }
+
+var errIncomplete = errors.New("脚本未执行到最后一步")
+
+// Retryable reports whether handling the same QR URL again may succeed: scripts and
+// commands that failed or timed out are, a missing interpreter or a cancelled sign is not.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrNotInstalled) || errors.Is(err, exec.ErrNotFound) {
+		return false
 	}
-	return "", fmt.Errorf("AutoHotkey 未找到，请安装或设置环境变量 AUTOHOTKEY_EXE")
+	var se *ScriptError
+	var ee *exec.ExitError
+	return errors.As(err, &se) || errors.As(err, &ee) || errors.Is(err, context.DeadlineExceeded)
 }
 
-// LaunchWeChatScreenshot shows the QR PNG in a topmost window via AutoHotkey,
+// RunWeChatScreenshot shows the QR PNG in a topmost window via AutoHotkey,
 // triggers WeChat screenshot (Alt+A), drags the selection over the image, clicks center,
-// and optionally clicks an absolute "recognize" button at (recognizeX, recognizeY) if provided (>0).
-// x,y specify screen position; width/height are derived from pngSize.
-func LaunchWeChatScreenshot(pngPath string, x, y, pngSize int, recognizeX, recognizeY int) error {
-	ahk, err := findAutoHotkey()
+// and optionally clicks an absolute "recognize" button (RecognizeX/Y > 0).
+// version selects the script dialect (auto, v1 or v2). It waits for the script until ctx
+// is done, removes the script file and returns a *ScriptError unless every step ran.
+func RunWeChatScreenshot(ctx context.Context, version string, p ScriptParams) (ScriptRun, error) {
+	ahk, v, err := findAutoHotkey(version)
 	if err != nil {
-		return err
+		return ScriptRun{}, err
 	}
-	if pngSize <= 0 {
-		pngSize = 300
+	run := ScriptRun{Exe: ahk, Version: v, ExitCode: -1}
+	log.Debug("autohotkey found", "exe", ahk, "version", v)
+	script, err := RenderScript(v, p)
+	if err != nil {
+		return run, err
 	}
-	// Build temporary AHK script (v1 syntax)
-	script := fmt.Sprintf(`
-#NoTrayIcon
-#SingleInstance, Force
-SetBatchLines, -1
-CoordMode, Mouse, Screen
-DllCall("SetProcessDPIAware")
-x := %d
-y := %d
-w := %d
-h := %d
-img := "%s"
-rx := %d
-ry := %d
-Gui, -DPIScale
-Gui, +AlwaysOnTop -Caption +ToolWindow
-Gui, Margin, 0, 0
-Gui, Add, Picture, x0 y0 w%v h%v vPic, %s
-Gui, Show, x%%x%% y%%y%% NoActivate, QRShow
-Sleep, 150
-; Activate WeChat (best-effort)
-WinActivate, ahk_exe WeChat.exe
-Sleep, 120
-Send, !a
-Sleep, 150
-; Drag selection
-tx := x + w
-ty := y + h
-MouseMove, %%x%%, %%y%%, 0
-Sleep, 50
-Click, down
-Sleep, 60
-MouseMove, %%tx%%, %%ty%%, 0
-Sleep, 80
-Click, up
-Sleep, 300
-; Click center to trigger recognition bubble
-cx := x + w/2
-cy := y + h/2
-MouseClick, left, %%cx%%, %%cy%%
-Sleep, 500
-; Optionally click absolute position for "识别二维码" icon/button
-if (rx > 0 && ry > 0) {
-	MouseClick, left, %%rx%%, %%ry%%
-}
-Sleep, 800
-Gui, Destroy
-ExitApp
-`, x, y, pngSize, pngSize, escapeAHKPath(pngPath), recognizeX, recognizeY, pngSize, pngSize, escapeAHKPath(pngPath))
-
-	tmp := filepath.Join(os.TempDir(), fmt.Sprintf("wzj_wechat_autoqr_%d.ahk", time.Now().UnixNano()))
-	if err := os.WriteFile(tmp, []byte(script), 0644); err != nil {
-		return err
+	tmp := artifactPath(fmt.Sprintf("wzj_wechat_autoqr_%d.ahk", time.Now().UnixNano()))
+	// UTF-8 BOM：v1 默认按 ANSI 读取脚本，中文路径需要 BOM；v2 同样接受
+	script = append([]byte("\xEF\xBB\xBF"), script...)
+	if err := os.WriteFile(tmp, script, 0644); err != nil {
+		return run, err
 	}
-	cmd := exec.Command(ahk, tmp)
-	return cmd.Start()
-}
+	defer os.Remove(tmp)
 
-func escapeAHKPath(p string) string {
-	// AHK uses backslashes; ensure escaping quotes
-	s := strings.ReplaceAll(p, `\`, `\\`)
-	s = strings.ReplaceAll(s, `"`, `\"`)
-	return s
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ahk, "/ErrorStdOut", tmp)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = time.Second
+	log.Debug("run autohotkey script", "script", tmp, "png", p.Image)
+	start := time.Now()
+	err = cmd.Run()
+	run.Duration = time.Since(start)
+	if cmd.ProcessState != nil && cmd.ProcessState.Exited() {
+		run.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	var other []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(line, "step:"); ok {
+			run.Steps = append(run.Steps, name)
+		} else if line != "" {
+			other = append(other, line)
+		}
+	}
+	run.Stdout = strings.Join(other, "\n")
+	run.Stderr = strings.TrimSpace(stderr.String())
+	log.Debug("autohotkey script finished", "exit", run.ExitCode, "steps", run.Steps, "duration", run.Duration)
+	switch {
+	case ctx.Err() != nil:
+		return run, &ScriptError{Run: run, Err: ctx.Err()}
+	case err != nil:
+		return run, &ScriptError{Run: run, Err: err}
+	case !run.Done():
+		return run, &ScriptError{Run: run, Err: errIncomplete}
+	}
+	return run, nil
 }
@@ -0,0 +1,80 @@
+package autoqr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// execScanner runs a user command for every QR URL. Each argument is a text/template
+// with .URL and .PNG; the same values are passed as WZJ_QR_URL / WZJ_QR_PNG.
+type execScanner struct {
+	args    []*template.Template
+	png     pngCache
+	timeout time.Duration
+}
+
+func newExecScanner(opts Options) (Scanner, error) {
+	if len(opts.Command) == 0 {
+		return nil, errors.New("autoqr_mode exec requires autoqr_command")
+	}
+	s := &execScanner{png: pngCache{size: opts.PNGSize}, timeout: opts.Timeout}
+	for i, a := range opts.Command {
+		t, err := template.New(fmt.Sprintf("arg%d", i)).Option("missingkey=error").Parse(a)
+		if err != nil {
+			return nil, fmt.Errorf("autoqr_command[%d]: %w", i, err)
+		}
+		s.args = append(s.args, t)
+	}
+	return s, nil
+}
+
+func (e *execScanner) Name() string { return "exec" }
+
+func (e *execScanner) Handle(ctx context.Context, qrURL string) (Result, error) {
+	res := Result{Scanner: e.Name()}
+	png, err := e.png.get(qrURL)
+	if err != nil {
+		return res, fmt.Errorf("生成二维码 PNG 失败: %w", err)
+	}
+	res.PNG = png
+	data := struct{ URL, PNG string }{qrURL, png}
+	argv := make([]string, len(e.args))
+	for i, t := range e.args {
+		var b bytes.Buffer
+		if err := t.Execute(&b, data); err != nil {
+			return res, err
+		}
+		argv[i] = b.String()
+	}
+	ctx, cancel := withTimeout(ctx, e.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), "WZJ_QR_URL="+qrURL, "WZJ_QR_PNG="+png)
+	// 命令派生的子进程可能一直占着输出管道，超时后最多再等 1 秒
+	cmd.WaitDelay = time.Second
+	log.Debug("exec scanner", "cmd", argv[0], "png", png)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		log.Debug("exec scanner output", "output", strings.TrimSpace(string(out)))
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return res, fmt.Errorf("%s: %w", argv[0], err)
+	}
+	res.Triggered = true
+	return res, nil
+}
+
+func (e *execScanner) Close() error {
+	e.png.remove()
+	return nil
+}
@@ -0,0 +1,59 @@
+package autoqr
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestExecScannerTimeoutWithBackgroundChild(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	// 后台的 sleep 继承了输出管道，直接子进程被杀后管道仍未关闭
+	s, err := newExecScanner(Options{
+		Command: []string{"sh", "-c", "sleep 30 & sleep 30"},
+		Timeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	start := time.Now()
+	_, err = s.Handle(context.Background(), "https://www.teachermate.com.cn/qr?t=1")
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Handle returned after %v, want about timeout + WaitDelay", d)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+}
+
+func TestExecScannerPassesURL(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	const url = "https://www.teachermate.com.cn/qr?t=2"
+	s, err := newExecScanner(Options{
+		Command: []string{"sh", "-c", `test "$1" = "$WZJ_QR_URL" && test -s "$2"`, "sh", "{{.URL}}", "{{.PNG}}"},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	res, err := s.Handle(context.Background(), url)
+	if err != nil || !res.Triggered {
+		t.Fatalf("Handle() = %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,191 @@
+package autoqr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Result describes what a scanner did with one QR URL.
+type Result struct {
+	Scanner   string   // 后端名称
+	PNG       string   // 生成的二维码图片（若有）
+	Triggered bool     // 是否自动触发了识别（manual 为 false）
+	Steps     []string // 脚本报告的已完成步骤（autohotkey）
+}
+
+// Scanner turns a QR URL into a sign-in attempt: show it, drive a recognizer, or
+// hand it to an external program. One Scanner serves one sign; Close removes its files.
+type Scanner interface {
+	Name() string
+	Handle(ctx context.Context, qrURL string) (Result, error)
+	Close() error
+}
+
+// Options carries the autoqr_* settings shared by the backends.
+type Options struct {
+	PNGSize    int // 二维码图片边长
+	X, Y       int // 图片窗口左上角
+	RecognizeX int // 识别按钮绝对坐标（0 表示不点击）
+	RecognizeY int
+	Command    []string      // exec 后端的命令及参数（text/template）
+	AHKVersion string        // AutoHotkey 脚本方言：auto / v1 / v2
+	Timeout    time.Duration // 单次脚本/命令的最长运行时间，0 表示不限制
+}
+
+// Factory builds a scanner from options.
+type Factory func(opts Options) (Scanner, error)
+
+var (
+	regMu    sync.RWMutex
+	registry = map[string]Factory{}
+)
+
+// Register makes a backend selectable by autoqr_mode; later registrations replace earlier ones.
+func Register(name string, f Factory) {
+	regMu.Lock()
+	registry[name] = f
+	regMu.Unlock()
+}
+
+// Names lists the registered backends.
+func Names() []string {
+	regMu.RLock()
+	defer regMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check reports whether name is a registered backend.
+func Check(name string) error {
+	regMu.RLock()
+	_, ok := registry[name]
+	regMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown autoqr_mode %q (available: %v)", name, Names())
+	}
+	return nil
+}
+
+// New builds the backend registered under name.
+func New(name string, opts Options) (Scanner, error) {
+	regMu.RLock()
+	f, ok := registry[name]
+	regMu.RUnlock()
+	if !ok {
+		return nil, Check(name)
+	}
+	return f(opts)
+}
+
+func init() {
+	Register("manual", func(Options) (Scanner, error) { return &manualScanner{}, nil })
+	Register("autohotkey", newAutoHotkeyScanner)
+	Register("exec", newExecScanner)
+}
+
+// manualScanner only tells the user to scan the terminal QR code themselves.
+type manualScanner struct {
+	told bool
+}
+
+func (m *manualScanner) Name() string { return "manual" }
+
+func (m *manualScanner) Handle(ctx context.Context, qrURL string) (Result, error) {
+	if !m.told {
+		m.told = true
+		log.Info("[QR] 手动模式：不会自动识别，请使用手机或 PC 微信扫描终端中的二维码")
+	}
+	return Result{Scanner: m.Name()}, nil
+}
+
+func (m *manualScanner) Close() error { return nil }
+
+// withTimeout bounds one backend run; d <= 0 only inherits ctx.
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// pngCache keeps the image of the latest URL; a new URL replaces (and deletes) the old one.
+type pngCache struct {
+	size int
+	url  string
+	path string
+}
+
+func (p *pngCache) get(url string) (string, error) {
+	if url == p.url && p.path != "" {
+		return p.path, nil
+	}
+	p.remove()
+	path, err := GenerateQRPng(url, p.size)
+	if err != nil {
+		return "", err
+	}
+	log.Info("[AutoQR] 已生成二维码图片", "path", path)
+	p.url, p.path = url, path
+	return path, nil
+}
+
+func (p *pngCache) remove() {
+	if p.path != "" {
+		_ = os.Remove(p.path)
+		p.url, p.path = "", ""
+	}
+}
+
+// autoHotkeyScanner drives the PC WeChat screenshot recognizer via AutoHotkey.
+type autoHotkeyScanner struct {
+	opts Options
+	png  pngCache
+}
+
+func newAutoHotkeyScanner(opts Options) (Scanner, error) {
+	if opts.AHKVersion == "" {
+		opts.AHKVersion = VersionAuto
+	}
+	if err := CheckVersion(opts.AHKVersion); err != nil {
+		return nil, err
+	}
+	return &autoHotkeyScanner{opts: opts, png: pngCache{size: opts.PNGSize}}, nil
+}
+
+func (a *autoHotkeyScanner) Name() string { return "autohotkey" }
+
+func (a *autoHotkeyScanner) Handle(ctx context.Context, qrURL string) (Result, error) {
+	res := Result{Scanner: a.Name()}
+	png, err := a.png.get(qrURL)
+	if err != nil {
+		return res, fmt.Errorf("生成二维码 PNG 失败: %w", err)
+	}
+	res.PNG = png
+	p := ScriptParams{Image: png, X: a.opts.X, Y: a.opts.Y, Size: a.opts.PNGSize, RecognizeX: a.opts.RecognizeX, RecognizeY: a.opts.RecognizeY}
+	ctx, cancel := withTimeout(ctx, a.opts.Timeout)
+	defer cancel()
+	run, err := RunWeChatScreenshot(ctx, a.opts.AHKVersion, p)
+	res.Steps = run.Steps
+	if err != nil {
+		return res, err
+	}
+	if slices.Contains(run.Steps, "wechat_missing") {
+		log.Warn("[AutoQR] 未找到微信窗口，已直接发送 Alt+A；如未弹出截图请确认 PC 微信已登录")
+	}
+	res.Triggered = true
+	return res, nil
+}
+
+func (a *autoHotkeyScanner) Close() error {
+	a.png.remove()
+	return nil
+}
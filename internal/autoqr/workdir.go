@@ -0,0 +1,203 @@
+package autoqr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 锁文件每 lockHeartbeat 刷新一次修改时间；超过 staleAfter 未刷新的目录视为崩溃残留。
+// 清理者须先以 O_EXCL 在 Root 下创建 <目录名>.break 才能删除该目录，多个同时启动的实例只有一个会动手。
+const (
+	lockName      = "lock"
+	breakSuffix   = ".break"
+	lockHeartbeat = time.Minute
+	staleAfter    = 5 * time.Minute
+)
+
+// Workdir is a per-process directory under Root for generated PNGs and AHK scripts.
+// Its lockfile is created exclusively and touched while the process runs; the mtime
+// only tells a later run whether the owner is gone, and removing a stale directory
+// first takes an exclusive claim on it so concurrent starts never race over it.
+type Workdir struct {
+	Root string
+	Dir  string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// DefaultWorkdirRoot is used when autoqr_workdir is empty.
+func DefaultWorkdirRoot() string {
+	return filepath.Join(os.TempDir(), "wzj-autoqr")
+}
+
+// OpenWorkdir removes stale run directories under root (and loose files of older
+// versions in os.TempDir), then creates and locks a fresh one for this process.
+func OpenWorkdir(root string) (*Workdir, error) {
+	if root == "" {
+		root = DefaultWorkdirRoot()
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	cleanStale(root, time.Now())
+	dir, err := os.MkdirTemp(root, fmt.Sprintf("run-%d-", os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+	if err := createExclusive(filepath.Join(dir, lockName)); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	w := &Workdir{Root: root, Dir: dir, stop: make(chan struct{}), done: make(chan struct{})}
+	go w.heartbeat()
+	log.Debug("autoqr workdir", "dir", dir)
+	return w, nil
+}
+
+func (w *Workdir) heartbeat() {
+	defer close(w.done)
+	t := time.NewTicker(lockHeartbeat)
+	defer t.Stop()
+	lock := filepath.Join(w.Dir, lockName)
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-t.C:
+			if err := os.Chtimes(lock, now, now); err != nil {
+				// 通常是进程挂起过久、目录已被其他实例当作残留清理
+				log.Warn("autoqr workdir lock lost", "dir", w.Dir, "err", err)
+			}
+		}
+	}
+}
+
+// Path returns name inside the directory.
+func (w *Workdir) Path(name string) string {
+	return filepath.Join(w.Dir, name)
+}
+
+// Close stops the heartbeat and removes the directory with everything in it.
+func (w *Workdir) Close() error {
+	close(w.stop)
+	<-w.done
+	return os.RemoveAll(w.Dir)
+}
+
+// createExclusive creates path with O_EXCL and writes the owner pid into it; it fails
+// if the file already exists.
+func createExclusive(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	info, _ := json.Marshal(map[string]any{"pid": os.Getpid(), "started": time.Now().Format(time.RFC3339)})
+	_, err = f.Write(info)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// stale reports whether the lock in dir was not refreshed within staleAfter. A directory
+// without a lock counts as stale only once the directory itself is that old, since its
+// owner may still be about to create the lock.
+func stale(dir string, now time.Time) bool {
+	fi, err := os.Stat(filepath.Join(dir, lockName))
+	if os.IsNotExist(err) {
+		fi, err = os.Stat(dir)
+	}
+	if err != nil {
+		return false // 无法判断，保留
+	}
+	return now.Sub(fi.ModTime()) >= staleAfter
+}
+
+// claim takes the exclusive right to remove dir. A claim left behind by a cleaner that
+// crashed itself is broken once it is older than staleAfter.
+func claim(dir string, now time.Time) bool {
+	path := dir + breakSuffix
+	err := createExclusive(path)
+	if os.IsExist(err) {
+		if fi, serr := os.Stat(path); serr == nil && now.Sub(fi.ModTime()) >= staleAfter && os.Remove(path) == nil {
+			err = createExclusive(path)
+		}
+	}
+	return err == nil
+}
+
+// cleanStale removes run directories whose lock is missing or was not refreshed within
+// staleAfter, plus wzj_autoqr_*.png / wzj_wechat_autoqr_*.ahk that older versions wrote
+// straight into os.TempDir.
+func cleanStale(root string, now time.Time) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "run-") {
+			continue
+		}
+		dir := filepath.Join(root, e.Name())
+		if !e.IsDir() {
+			// 清理者中途崩溃留下的 .break，对应目录已不存在
+			if strings.HasSuffix(e.Name(), breakSuffix) {
+				if _, err := os.Stat(strings.TrimSuffix(dir, breakSuffix)); os.IsNotExist(err) {
+					if info, err := e.Info(); err == nil && now.Sub(info.ModTime()) >= staleAfter {
+						os.Remove(dir)
+					}
+				}
+			}
+			continue
+		}
+		if !stale(dir, now) || !claim(dir, now) {
+			continue // 其他运行中的实例，或已有实例在清理
+		}
+		// 拿到清理权后再确认一次：判断与加锁之间原主人可能刚刷新过心跳
+		if !stale(dir, now) {
+			os.Remove(dir + breakSuffix)
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warn("remove stale autoqr workdir", "dir", dir, "err", err)
+		} else {
+			log.Info("已清理残留的 autoqr 临时目录", "dir", dir)
+		}
+		os.Remove(dir + breakSuffix)
+	}
+	for _, pattern := range []string{"wzj_autoqr_*.png", "wzj_wechat_autoqr_*.ahk"} {
+		matches, _ := filepath.Glob(filepath.Join(os.TempDir(), pattern))
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && now.Sub(fi.ModTime()) >= staleAfter {
+				os.Remove(m)
+			}
+		}
+	}
+}
+
+var (
+	wdMu sync.RWMutex
+	wd   *Workdir
+)
+
+// SetWorkdir makes generated files go to w; nil falls back to os.TempDir().
+func SetWorkdir(w *Workdir) {
+	wdMu.Lock()
+	wd = w
+	wdMu.Unlock()
+}
+
+// artifactPath returns where a generated file named name should be written.
+func artifactPath(name string) string {
+	wdMu.RLock()
+	defer wdMu.RUnlock()
+	if wd != nil {
+		return wd.Path(name)
+	}
+	return filepath.Join(os.TempDir(), name)
+}
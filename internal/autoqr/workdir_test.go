@@ -0,0 +1,113 @@
+package autoqr
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runDir creates root/name with a lock (if lockAge >= 0) and sets the ages of both.
+func runDir(t *testing.T, root, name string, lockAge, dirAge time.Duration) string {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if lockAge >= 0 {
+		lock := filepath.Join(dir, lockName)
+		if err := createExclusive(lock); err != nil {
+			t.Fatal(err)
+		}
+		at := time.Now().Add(-lockAge)
+		if err := os.Chtimes(lock, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := time.Now().Add(-dirAge)
+	if err := os.Chtimes(dir, at, at); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestOpenWorkdirLockIsExclusive(t *testing.T) {
+	w, err := OpenWorkdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := w.Path(lockName)
+	if fi, err := os.Stat(lock); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("lock = %v, %v", fi, err)
+	}
+	if err := createExclusive(lock); !os.IsExist(err) {
+		t.Fatalf("second lock on the same dir: err = %v, want exists", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if exists(w.Dir) {
+		t.Fatal("workdir left behind after Close")
+	}
+}
+
+func TestCleanStaleConcurrentStarts(t *testing.T) {
+	root := t.TempDir()
+	live := runDir(t, root, "run-1-live", 30*time.Second, time.Hour)
+	dead := runDir(t, root, "run-2-dead", time.Hour, time.Hour)
+	fresh := runDir(t, root, "run-3-fresh", -1, 0)           // 刚创建、尚未加锁
+	orphan := runDir(t, root, "run-4-orphan", -1, time.Hour) // 加锁前就崩溃了
+
+	// 多个实例同时启动，各自清理同一个根目录
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cleanStale(root, time.Now())
+		}()
+	}
+	wg.Wait()
+
+	if !exists(live) || !exists(fresh) {
+		t.Fatal("a live or just-created workdir was removed")
+	}
+	if exists(dead) || exists(orphan) {
+		t.Fatal("stale workdir not removed")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(root, "*"+breakSuffix)); len(matches) != 0 {
+		t.Fatalf("claims left behind: %v", matches)
+	}
+}
+
+func TestCleanStaleHonoursClaims(t *testing.T) {
+	root := t.TempDir()
+	busy := runDir(t, root, "run-1-busy", time.Hour, time.Hour)
+	abandoned := runDir(t, root, "run-2-abandoned", time.Hour, time.Hour)
+	if err := createExclusive(busy + breakSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if err := createExclusive(abandoned + breakSuffix); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(abandoned+breakSuffix, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanStale(root, time.Now())
+
+	// 另一个实例正在清理的目录不动；清理者自己崩溃留下的旧 claim 会被接管
+	if !exists(busy) || !exists(busy+breakSuffix) {
+		t.Fatal("removed a workdir claimed by another cleaner")
+	}
+	if exists(abandoned) || exists(abandoned+breakSuffix) {
+		t.Fatal("abandoned claim not taken over")
+	}
+}
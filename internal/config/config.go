@@ -1,45 +1,110 @@
 package config
 
 import (
-	"encoding/json"
 	_ "errors"
 	"fmt"
 	"os"
+	"strings"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qr"
 )
 
 type Config struct {
-	Polling_interval     int     `json:"polling_interval"`
-	Start_delay          int     `json:"start_delay"`
-	Start_delay_gps      int     `json:"start_delay_gps"`
-	Start_delay_qr       int     `json:"start_delay_qr"`
-	Lat                  float64 `json:"lat"`
-	Lon                  float64 `json:"lon"`
-	Lat_W12              float64 `json:"lat_w12"`
-	Lon_W12              float64 `json:"lon_w12"`
-	Lat_S1               float64 `json:"lat_s1"`
-	Lon_S1               float64 `json:"lon_s1"`
-	Ua                   string  `json:"ua"`
-	Max_polling_attempts int     `json:"max_polling_attempts"`
-	Debug                int     `json:"debug"`
-	AutoQRMode           string  `json:"autoqr_mode"`        // "manual" 或 "autohotkey"
-	AutoQRIntervalMS     int     `json:"autoqr_interval_ms"` // 自动重扫间隔，毫秒
-	AutoQRX              int     `json:"autoqr_x"`           // 二维码窗口左上角X
-	AutoQRY              int     `json:"autoqr_y"`           // 二维码窗口左上角Y
-	AutoQRSize           int     `json:"autoqr_size"`        // 二维码图片边长
-	AutoQRRecognizeX     int     `json:"autoqr_recognize_x"` // 识别按钮绝对X（可选）
-	AutoQRRecognizeY     int     `json:"autoqr_recognize_y"` // 识别按钮绝对Y（可选）
+	Polling_interval      int               `json:"polling_interval"`
+	Start_delay           int               `json:"start_delay"`
+	Start_delay_gps       int               `json:"start_delay_gps"`
+	Start_delay_qr        int               `json:"start_delay_qr"`
+	Lat                   float64           `json:"lat"`
+	Lon                   float64           `json:"lon"`
+	Lat_W12               float64           `json:"lat_w12"`
+	Lon_W12               float64           `json:"lon_w12"`
+	Lat_S1                float64           `json:"lat_s1"`
+	Lon_S1                float64           `json:"lon_s1"`
+	Ua                    string            `json:"ua"`
+	Max_polling_attempts  int               `json:"max_polling_attempts"`
+	Debug                 int               `json:"debug"`
+	AutoQRMode            string            `json:"autoqr_mode"`              // 扫描后端："manual" / "autohotkey" / "exec"
+	AutoQRIntervalMS      int               `json:"autoqr_interval_ms"`       // 自动重扫间隔，毫秒
+	AutoQRMaxAttempts     int               `json:"autoqr_max_attempts"`      // 每个签到最多运行扫描后端的次数，默认 30，负数不限制
+	AutoQRX               int               `json:"autoqr_x"`                 // 二维码窗口左上角X
+	AutoQRY               int               `json:"autoqr_y"`                 // 二维码窗口左上角Y
+	AutoQRSize            int               `json:"autoqr_size"`              // 二维码图片边长
+	AutoQRRecognizeX      int               `json:"autoqr_recognize_x"`       // 识别按钮绝对X（可选）
+	AutoQRRecognizeY      int               `json:"autoqr_recognize_y"`       // 识别按钮绝对Y（可选）
+	AutoQRCommand         []string          `json:"autoqr_command"`           // exec 模式执行的命令及参数（模板，可用 {{.URL}} {{.PNG}}）
+	AutoQRAHKVersion      string            `json:"autoqr_ahk_version"`       // AutoHotkey 脚本方言："auto"（按找到的解释器判断）/ "v1" / "v2"
+	AutoQRTimeoutMS       int               `json:"autoqr_timeout_ms"`        // 单次 AutoHotkey 脚本/exec 命令的最长运行时间（毫秒）
+	AutoQRWorkdir         string            `json:"autoqr_workdir"`           // 二维码图片与脚本的临时目录根，为空时使用系统临时目录下的 wzj-autoqr
+	QRMode                string            `json:"qr_mode"`                  // 终端二维码：full（色块）/ half（半块字符，更小）/ ascii
+	QRLevel               string            `json:"qr_level"`                 // 纠错级别 L/M/Q/H
+	QRInvert              bool              `json:"qr_invert"`                // 反色，浅色终端主题使用
+	QRQuietZone           int               `json:"qr_quiet_zone"`            // 四周留白（模块数），0 取默认 1，负数不留白
+	QROutputs             []string          `json:"qr_outputs"`               // 二维码输出目标："terminal" 或 .png/.svg 文件路径（每次刷新原子替换）
+	QRPNGSize             int               `json:"qr_png_size"`              // qr_outputs 中 PNG 的边长（像素）
+	WSReadTimeoutMS       int               `json:"ws_read_timeout_ms"`       // 超过该时长未收到任何帧即判定连接失效
+	WSWriteTimeoutMS      int               `json:"ws_write_timeout_ms"`      // 单次写入超时
+	WSPingIntervalMS      int               `json:"ws_ping_interval_ms"`      // WebSocket ping 间隔
+	WSMaxMessageSize      int64             `json:"ws_max_message_size"`      // 单帧最大字节数
+	WSRecordFile          string            `json:"ws_record_file"`           // 非空时记录全部 WS 收发帧（JSONL），可用 replay 子命令回放
+	WSDiscoveryFile       string            `json:"ws_discovery_file"`        // 记录未识别的 WS 消息（每类首条，已脱敏，JSONL），"none" 只在内存计数
+	HTTPCassette          string            `json:"http_cassette"`            // 非空时启用 HTTP cassette（openid 已脱敏）
+	HTTPCassetteMode      string            `json:"http_cassette_mode"`       // "record" 或 "replay"
+	LogLevel              string            `json:"log_level"`                // debug/info/warn/error；debug=1 时视为 debug
+	LogLevels             map[string]string `json:"log_levels"`               // 按子系统覆盖级别：main/qrws/requests/autoqr
+	LogFormat             string            `json:"log_format"`               // "text" 或 "json"
+	LogFile               string            `json:"log_file"`                 // 非空时同时写入文件（按大小轮转）
+	LogMaxSizeMB          int               `json:"log_max_size_mb"`          // 单个日志文件上限（MB）
+	LogMaxBackups         int               `json:"log_max_backups"`          // 保留的轮转文件个数
+	CredentialFile        string            `json:"credential_file"`          // 保存已验证 openid 的文件（0600），"none" 关闭
+	CredentialEncrypt     bool              `json:"credential_encrypt"`       // 用口令加密保存（口令取自 WZJ_CRED_PASSPHRASE 或启动时输入）
+	OpenIDCheckIntervalMS int               `json:"openid_check_interval_ms"` // 定期校验 openid 的间隔（毫秒）
+	Notify                []NotifySink      `json:"notify"`                   // 通知渠道：webhook/smtp/command
+	HTTPAddr              string            `json:"http_addr"`                // 本地状态页/API 监听地址（如 127.0.0.1:8765），为空不启用
+	MetricsPath           string            `json:"metrics_path"`             // Prometheus 指标路径（挂在 http_addr 上），默认 /metrics，"none" 关闭
+	ControlToken          string            `json:"control_token"`            // 非空时 /control 需要 Bearer token（也可用环境变量 WZJ_CONTROL_TOKEN）
+	ConfigWatchIntervalMS int               `json:"config_watch_interval_ms"` // 检查配置文件变化的间隔（毫秒），默认 2000，负数关闭热加载
+}
+
+// NotifySink configures one notification channel.
+type NotifySink struct {
+	Type     string            `json:"type"`     // "webhook" / "smtp" / "command"
+	Events   []string          `json:"events"`   // 只发送这些事件，空表示全部
+	Title    string            `json:"title"`    // 标题模板（text/template，可用 .Event .Fields .Time）
+	Template string            `json:"template"` // 正文模板
+	URL      string            `json:"url"`      // webhook
+	Headers  map[string]string `json:"headers"`  // webhook 额外请求头
+	SMTPAddr string            `json:"smtp_addr"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+	From     string            `json:"from"`
+	To       []string          `json:"to"`
+	Command  []string          `json:"command"` // 命令及参数，每个参数都是模板
 }
 
+// Path is the default config file; see FindPath for the other formats.
+const Path = "config.json"
+
+// Load reads the config from the default file, then WZJ_* environment variables.
 func Load() (*Config, error) {
-	cfg_path := "config.json"
-	data, err := os.ReadFile(cfg_path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
-	}
+	return (&Loader{Path: FindPath(), Env: os.Environ()}).Load()
+}
+
+// LoadFile reads one config file (format by extension), fills in defaults and validates it.
+func LoadFile(cfg_path string) (*Config, error) {
+	return (&Loader{Path: cfg_path}).Load()
+}
+
+// Defaults returns the built-in configuration used under every file.
+func Defaults() *Config {
 	cfg := &Config{}
-	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
-	}
+	applyDefaults(cfg)
+	return cfg
+}
+
+// applyDefaults fills zero or out-of-range values; it runs before and after the layers
+// so that 0 in a file still means "default", as it always has.
+func applyDefaults(cfg *Config) {
 	if cfg.Polling_interval <= 0 {
 		cfg.Polling_interval = 4000
 	}
@@ -53,6 +118,23 @@ func Load() (*Config, error) {
 	if cfg.Debug != 1 {
 		cfg.Debug = 0
 	}
+	if cfg.MetricsPath == "" {
+		cfg.MetricsPath = "/metrics"
+	} else if cfg.MetricsPath != "none" && !strings.HasPrefix(cfg.MetricsPath, "/") {
+		cfg.MetricsPath = "/" + cfg.MetricsPath
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = "text"
+	}
+	if cfg.LogMaxSizeMB <= 0 {
+		cfg.LogMaxSizeMB = 10
+	}
+	if cfg.LogMaxBackups <= 0 {
+		cfg.LogMaxBackups = 3
+	}
 	// 默认启用 AutoHotkey 模式
 	if cfg.AutoQRMode == "" {
 		cfg.AutoQRMode = "autohotkey"
@@ -60,6 +142,9 @@ func Load() (*Config, error) {
 	if cfg.AutoQRIntervalMS <= 0 {
 		cfg.AutoQRIntervalMS = 4000
 	}
+	if cfg.AutoQRMaxAttempts == 0 {
+		cfg.AutoQRMaxAttempts = 30
+	}
 	if cfg.AutoQRX <= 0 {
 		cfg.AutoQRX = 420
 	}
@@ -76,5 +161,102 @@ func Load() (*Config, error) {
 	if cfg.AutoQRRecognizeY <= 0 {
 		cfg.AutoQRRecognizeY = 520
 	}
-	return cfg, nil
+	if cfg.AutoQRTimeoutMS <= 0 {
+		cfg.AutoQRTimeoutMS = 15000
+	}
+	if cfg.AutoQRAHKVersion == "" {
+		cfg.AutoQRAHKVersion = "auto"
+	}
+	if cfg.QRMode == "" {
+		cfg.QRMode = "full"
+	}
+	if cfg.QRLevel == "" {
+		cfg.QRLevel = "M"
+	}
+	if cfg.QROutputs == nil {
+		cfg.QROutputs = []string{"terminal"}
+	}
+	if cfg.QRPNGSize <= 0 {
+		cfg.QRPNGSize = 320
+	}
+	if cfg.HTTPCassette != "" && cfg.HTTPCassetteMode == "" {
+		cfg.HTTPCassetteMode = "record"
+	}
+	if cfg.CredentialFile == "" {
+		cfg.CredentialFile = ".wzj_openid.json"
+	}
+	if cfg.OpenIDCheckIntervalMS <= 0 {
+		cfg.OpenIDCheckIntervalMS = 600000
+	}
+	// WS 保活：ping 间隔需小于读超时，否则正常连接也会被判定失效
+	if cfg.WSReadTimeoutMS <= 0 {
+		cfg.WSReadTimeoutMS = 90000
+	}
+	if cfg.WSWriteTimeoutMS <= 0 {
+		cfg.WSWriteTimeoutMS = 10000
+	}
+	if cfg.WSPingIntervalMS <= 0 || cfg.WSPingIntervalMS >= cfg.WSReadTimeoutMS {
+		cfg.WSPingIntervalMS = cfg.WSReadTimeoutMS / 3
+	}
+	if cfg.WSMaxMessageSize <= 0 {
+		cfg.WSMaxMessageSize = 1 << 20
+	}
+	if cfg.WSDiscoveryFile == "" {
+		cfg.WSDiscoveryFile = "ws_discovery.jsonl"
+	}
+	if cfg.ConfigWatchIntervalMS == 0 {
+		cfg.ConfigWatchIntervalMS = 2000
+	}
+}
+
+// Validate rejects values that defaults cannot repair.
+func (c *Config) Validate() error {
+	// 具体可用的后端由调用方通过 Loader.Check 校验（autoqr 注册表）
+	if strings.TrimSpace(c.AutoQRMode) == "" {
+		return fmt.Errorf("autoqr_mode is empty")
+	}
+	switch c.AutoQRAHKVersion {
+	case "auto", "v1", "v2":
+	default:
+		return fmt.Errorf("autoqr_ahk_version must be auto, v1 or v2, got %q", c.AutoQRAHKVersion)
+	}
+	switch c.QRMode {
+	case "full", "half", "ascii":
+	default:
+		return fmt.Errorf("qr_mode must be full, half or ascii, got %q", c.QRMode)
+	}
+	switch strings.ToUpper(c.QRLevel) {
+	case "L", "M", "Q", "H":
+	default:
+		return fmt.Errorf("qr_level must be L, M, Q or H, got %q", c.QRLevel)
+	}
+	for _, out := range c.QROutputs {
+		if err := qr.CheckOutput(out); err != nil {
+			return fmt.Errorf("qr_outputs: %w", err)
+		}
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("log_level: %w", err)
+	}
+	for sub, lvl := range c.LogLevels {
+		if _, err := logging.ParseLevel(lvl); err != nil {
+			return fmt.Errorf("log_levels.%s: %w", sub, err)
+		}
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("log_format must be text or json, got %q", c.LogFormat)
+	}
+	if c.HTTPCassette != "" && c.HTTPCassetteMode != "record" && c.HTTPCassetteMode != "replay" {
+		return fmt.Errorf("http_cassette_mode must be record or replay, got %q", c.HTTPCassetteMode)
+	}
+	coords := []struct {
+		name     string
+		lat, lon float64
+	}{{"lat/lon", c.Lat, c.Lon}, {"lat_w12/lon_w12", c.Lat_W12, c.Lon_W12}, {"lat_s1/lon_s1", c.Lat_S1, c.Lon_S1}}
+	for _, p := range coords {
+		if p.lat < -90 || p.lat > 90 || p.lon < -180 || p.lon > 180 {
+			return fmt.Errorf("%s out of range: %v, %v", p.name, p.lat, p.lon)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes environment overrides: polling_interval -> WZJ_POLLING_INTERVAL.
+const EnvPrefix = "WZJ_"
+
+// Loader builds a Config in layers: built-in defaults < file < environment < flags.
+type Loader struct {
+	Path  string            // 配置文件；扩展名决定格式：.json / .yaml / .yml / .toml
+	Env   []string          // KEY=VALUE 列表（通常为 os.Environ()），只读取 WZJ_ 前缀的字段名
+	Flags map[string]string // 命令行覆盖：json 字段名 -> 值
+	// Check adds validation owned by other packages, e.g. that autoqr_mode names a
+	// registered scanner. It also runs on every hot reload.
+	Check func(*Config) error
+}
+
+// Load reads all layers, fills in defaults and validates the result.
+func (l *Loader) Load() (*Config, error) {
+	cfg := Defaults()
+	if err := decodeFile(l.Path, cfg); err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	for _, kv := range l.Env {
+		key, val, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, EnvPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, EnvPrefix))
+		if _, known := fieldIndex()[name]; !known {
+			continue // WZJ_CRED_PASSPHRASE 等非配置项
+		}
+		if err := setField(cfg, name, val); err != nil {
+			return nil, fmt.Errorf("env %s: %w", key, err)
+		}
+	}
+	for name, val := range l.Flags {
+		if err := setField(cfg, name, val); err != nil {
+			return nil, fmt.Errorf("flag -%s: %w", name, err)
+		}
+	}
+	applyDefaults(cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if l.Check != nil {
+		if err := l.Check(cfg); err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// FindPath returns the first existing of config.json, config.yaml, config.yml and
+// config.toml; config.json when none exists, so the error names the usual file.
+func FindPath() string {
+	for _, p := range []string{Path, "config.yaml", "config.yml", "config.toml"} {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return Path
+}
+
+// decodeFile merges the file onto cfg. YAML and TOML are decoded to a map and passed
+// through encoding/json, so every format uses the same json field names.
+func decodeFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json", "":
+	case ".yaml", ".yml":
+		var m map[string]any
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(m); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		var m map[string]any
+		if err := toml.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(m); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config format %q (json, yaml, toml)", path, ext)
+	}
+	// 未知字段（拼写错误、已改名的旧字段）直接报错，而不是静默忽略
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// fieldIndex maps json field names to struct field indexes.
+func fieldIndex() map[string]int {
+	t := reflect.TypeOf(Config{})
+	idx := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		idx[jsonName(t.Field(i))] = i
+	}
+	return idx
+}
+
+// setField parses s into the named field: scalars directly, maps and lists as JSON.
+func setField(cfg *Config, name, s string) error {
+	i, ok := fieldIndex()[name]
+	if !ok {
+		return fmt.Errorf("unknown config field %q", name)
+	}
+	f := reflect.ValueOf(cfg).Elem().Field(i)
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		f.SetInt(n)
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		f.SetFloat(x)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		f.SetBool(b)
+	default:
+		v := reflect.New(f.Type())
+		if err := json.Unmarshal([]byte(s), v.Interface()); err != nil {
+			return fmt.Errorf("%s expects JSON: %w", name, err)
+		}
+		f.Set(v.Elem())
+	}
+	return nil
+}
+
+// FlagSet collects per-field command-line overrides.
+type FlagSet struct {
+	fs   *flag.FlagSet
+	vals map[string]*string
+}
+
+// BindFlags registers one flag per config field on fs, named after the json field
+// (-polling_interval=3000, -log_levels='{"qrws":"debug"}').
+func BindFlags(fs *flag.FlagSet) *FlagSet {
+	t := reflect.TypeOf(Config{})
+	f := &FlagSet{fs: fs, vals: map[string]*string{}}
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		usage := "覆盖配置项 " + name
+		if doc := fieldDocs[name]; doc != "" {
+			usage += "：" + doc
+		}
+		f.vals[name] = fs.String(name, "", usage)
+	}
+	return f
+}
+
+// Values returns the overrides actually given on the command line (after fs.Parse).
+func (f *FlagSet) Values() map[string]string {
+	out := map[string]string{}
+	f.fs.Visit(func(fl *flag.Flag) {
+		if v, ok := f.vals[fl.Name]; ok {
+			out[fl.Name] = *v
+		}
+	})
+	return out
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLayerPrecedence(t *testing.T) {
+	path := writeConfig(t, "config.json", `{
+  "polling_interval": 5000,
+  "start_delay": 2000,
+  "lat": 1.5,
+  "log_levels": {"qrws": "warn"}
+}`)
+	l := &Loader{
+		Path: path,
+		Env: []string{
+			"WZJ_POLLING_INTERVAL=6000",
+			"WZJ_START_DELAY=3000",
+			`WZJ_LOG_LEVELS={"qrws":"debug"}`,
+			"WZJ_CRED_PASSPHRASE=secret", // 非配置项，忽略
+			"POLLING_INTERVAL=1",         // 没有前缀，忽略
+			"PATH=/usr/bin",
+		},
+		Flags: map[string]string{"polling_interval": "7000"},
+	}
+	cfg, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := Defaults()
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"flag over env over file", cfg.Polling_interval, 7000},
+		{"env over file", cfg.Start_delay, 3000},
+		{"file over default", cfg.Lat, 1.5},
+		{"default", cfg.Max_polling_attempts, def.Max_polling_attempts},
+		{"env map", cfg.LogLevels, map[string]string{"qrws": "debug"}},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{
+  "polling_interval": 3000,
+  "lat": 30.5,
+  "qr_invert": true,
+  "autoqr_command": ["zbarimg", "{{.PNG}}"],
+  "log_levels": {"qrws": "debug"}
+}`,
+		"config.yaml": `
+polling_interval: 3000
+lat: 30.5
+qr_invert: true
+autoqr_command: ["zbarimg", "{{.PNG}}"]
+log_levels:
+  qrws: debug
+`,
+		"config.toml": `
+polling_interval = 3000
+lat = 30.5
+qr_invert = true
+autoqr_command = ["zbarimg", "{{.PNG}}"]
+
+[log_levels]
+qrws = "debug"
+`,
+	}
+	var first *Config
+	for name, body := range files {
+		cfg, err := LoadFile(writeConfig(t, name, body))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if cfg.Polling_interval != 3000 || cfg.Lat != 30.5 || !cfg.QRInvert ||
+			!reflect.DeepEqual(cfg.AutoQRCommand, []string{"zbarimg", "{{.PNG}}"}) || cfg.LogLevels["qrws"] != "debug" {
+			t.Fatalf("%s: %+v", name, cfg)
+		}
+		if first == nil {
+			first = cfg
+		} else if d := Diff(first, cfg); len(d) != 0 {
+			t.Fatalf("%s differs from the other formats: %v", name, d)
+		}
+	}
+
+	if _, err := LoadFile(writeConfig(t, "config.ini", "polling_interval=1")); err == nil {
+		t.Fatal("want error for an unsupported extension")
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name, file, body string
+	}{
+		{"json", "config.json", `{"polling_intervall": 3000}`},
+		{"yaml", "config.yaml", "polling_intervall: 3000\n"},
+		{"toml", "config.toml", "polling_intervall = 3000\n"},
+		{"nested", "config.json", `{"notify": [{"type": "webhook", "ulr": "http://x"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writeConfig(t, tt.file, tt.body))
+			if err == nil || !strings.Contains(err.Error(), "unknown field") {
+				t.Fatalf("err = %v, want unknown field", err)
+			}
+		})
+	}
+
+	path := writeConfig(t, "config.json", "{}")
+	if _, err := (&Loader{Path: path, Flags: map[string]string{"no_such_field": "1"}}).Load(); err == nil {
+		t.Fatal("want error for an unknown flag field")
+	}
+	if _, err := (&Loader{Path: path, Env: []string{"WZJ_POLLING_INTERVAL=fast"}}).Load(); err == nil {
+		t.Fatal("want error for a malformed env value")
+	}
+	if _, err := (&Loader{Path: path, Flags: map[string]string{"log_level": "loud"}}).Load(); err == nil {
+		t.Fatal("want validation error for log_level")
+	}
+}
+
+func TestTemplateLoadsAsDefaults(t *testing.T) {
+	for _, name := range []string{"config.yaml", "config.toml"} {
+		data, err := Template(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadFile(writeConfig(t, name, string(data)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if d := Diff(Defaults(), cfg); len(d) != 0 {
+			t.Fatalf("%s template differs from defaults: %v", name, d)
+		}
+	}
+	if _, err := Template("config.json"); err == nil {
+		t.Fatal("want error for a JSON template")
+	}
+}
+
+func TestDiffAndApplyReloadable(t *testing.T) {
+	old := Defaults()
+	next := Defaults()
+	next.Polling_interval = 1500
+	next.HTTPAddr = "127.0.0.1:9000"
+	next.LogLevels = map[string]string{"qrws": "debug"}
+	next.ControlToken = "s3cret"
+	next.AutoQRCommand = []string{} // nil 与空列表视为相同
+
+	changes := Diff(old, next)
+	var fields []string
+	for _, ch := range changes {
+		fields = append(fields, ch.Field)
+	}
+	want := []string{"polling_interval", "log_levels", "http_addr", "control_token"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("Diff fields = %v, want %v", fields, want)
+	}
+	for _, ch := range changes {
+		if ch.Field == "control_token" && strings.Contains(ch.String(), "s3cret") {
+			t.Fatalf("secret printed: %s", ch.String())
+		}
+	}
+
+	live := *old
+	applied, skipped := ApplyReloadable(&live, next, changes)
+	if len(applied) != 2 || applied[0].Field != "polling_interval" || applied[1].Field != "log_levels" {
+		t.Fatalf("applied = %v", applied)
+	}
+	if len(skipped) != 2 || skipped[0].Field != "http_addr" || skipped[1].Field != "control_token" {
+		t.Fatalf("skipped = %v", skipped)
+	}
+	if live.Polling_interval != 1500 || live.LogLevels["qrws"] != "debug" {
+		t.Fatalf("reloadable fields not applied: %+v", live)
+	}
+	if live.HTTPAddr != old.HTTPAddr || live.ControlToken != old.ControlToken {
+		t.Fatalf("restart-only fields changed: addr %q token %q", live.HTTPAddr, live.ControlToken)
+	}
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// reloadable lists the fields (by json name) that may change while running. Everything
+// else (WS/HTTP/log outputs, credentials, notify, ...) is only read at startup.
+var reloadable = map[string]bool{
+	"polling_interval":     true,
+	"start_delay":          true,
+	"start_delay_gps":      true,
+	"start_delay_qr":       true,
+	"lat":                  true,
+	"lon":                  true,
+	"lat_w12":              true,
+	"lon_w12":              true,
+	"lat_s1":               true,
+	"lon_s1":               true,
+	"max_polling_attempts": true,
+	"debug":                true,
+	"log_level":            true,
+	"log_levels":           true,
+	"autoqr_mode":          true,
+	"autoqr_interval_ms":   true,
+	"autoqr_max_attempts":  true,
+	"qr_mode":              true,
+	"qr_level":             true,
+	"qr_invert":            true,
+	"qr_quiet_zone":        true,
+	"qr_outputs":           true,
+	"qr_png_size":          true,
+	"autoqr_x":             true,
+	"autoqr_y":             true,
+	"autoqr_size":          true,
+	"autoqr_recognize_x":   true,
+	"autoqr_recognize_y":   true,
+	"autoqr_command":       true,
+	"autoqr_ahk_version":   true,
+	"autoqr_timeout_ms":    true,
+}
+
+// Change is one field that differs between two configs.
+type Change struct {
+	Field string // json 名称
+	Old   any
+	New   any
+}
+
+// Reloadable reports whether the field can be applied without a restart.
+func (c Change) Reloadable() bool {
+	return reloadable[c.Field]
+}
+
+// String renders the change for logs; secrets are not printed.
+func (c Change) String() string {
+	if sensitive(c.Field) {
+		return c.Field + ": (changed)"
+	}
+	return fmt.Sprintf("%s: %v -> %v", c.Field, c.Old, c.New)
+}
+
+func sensitive(field string) bool {
+	return field == "notify" || strings.Contains(field, "token") || strings.Contains(field, "password")
+}
+
+// jsonName returns the json key of a struct field.
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// Diff lists the fields that differ between a and b, in declaration order.
+func Diff(a, b *Config) []Change {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	t := va.Type()
+	var out []Change
+	for i := 0; i < t.NumField(); i++ {
+		fa, fb := va.Field(i).Interface(), vb.Field(i).Interface()
+		if k := va.Field(i).Kind(); (k == reflect.Map || k == reflect.Slice) && va.Field(i).Len() == 0 && vb.Field(i).Len() == 0 {
+			continue // nil 与空列表/空表视为相同
+		}
+		if !reflect.DeepEqual(fa, fb) {
+			out = append(out, Change{Field: jsonName(t.Field(i)), Old: fa, New: fb})
+		}
+	}
+	return out
+}
+
+// ApplyReloadable copies the reloadable fields listed in changes from src into dst and
+// returns which changes were applied and which need a restart.
+func ApplyReloadable(dst, src *Config, changes []Change) (applied, skipped []Change) {
+	vd, vs := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	index := fieldIndex()
+	for _, ch := range changes {
+		i, ok := index[ch.Field]
+		if !ok || !ch.Reloadable() {
+			skipped = append(skipped, ch)
+			continue
+		}
+		vd.Field(i).Set(vs.Field(i))
+		applied = append(applied, ch)
+	}
+	return applied, skipped
+}
+
+// Watcher polls a config file's modification time and reloads it when it changes.
+type Watcher struct {
+	Path     string
+	Interval time.Duration
+	// Load reads the config again; nil means LoadFile(Path). 分层配置时应传入同一个 Loader，
+	// 以便环境变量与命令行覆盖在重新加载后依然生效。
+	Load func() (*Config, error)
+	// OnChange receives the previous and the new valid config when they differ.
+	OnChange func(old, new *Config)
+	// OnError reports a changed file that could not be loaded; the old config stays.
+	OnError func(err error)
+}
+
+// Run watches until ctx is done; current is the config already in use.
+func (w *Watcher) Run(ctx context.Context, current *Config) {
+	if w.Interval <= 0 {
+		return
+	}
+	stat := func() (time.Time, int64) {
+		fi, err := os.Stat(w.Path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return fi.ModTime(), fi.Size()
+	}
+	lastMod, lastSize := stat()
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		mod, size := stat()
+		if mod.Equal(lastMod) && size == lastSize {
+			continue
+		}
+		lastMod, lastSize = mod, size
+		load := w.Load
+		if load == nil {
+			load = func() (*Config, error) { return LoadFile(w.Path) }
+		}
+		next, err := load()
+		if err != nil {
+			if w.OnError != nil {
+				w.OnError(err)
+			}
+			continue
+		}
+		if len(Diff(current, next)) == 0 {
+			continue
+		}
+		if w.OnChange != nil {
+			w.OnChange(current, next)
+		}
+		current = next
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fieldDocs documents every field for the config init template and -h output.
+var fieldDocs = map[string]string{
+	"polling_interval":         "轮询活跃签到的间隔（毫秒）",
+	"start_delay":              "检测到普通签到后等待多久再签到（毫秒）",
+	"start_delay_gps":          "检测到定位签到后的等待（毫秒）",
+	"start_delay_qr":           "检测到二维码签到后的等待（毫秒）",
+	"lat":                      "默认签到纬度（定位签到），0 表示不带坐标",
+	"lon":                      "默认签到经度",
+	"lat_w12":                  "西十二楼纬度（启动时选择 1 使用）",
+	"lon_w12":                  "西十二楼经度",
+	"lat_s1":                   "南一楼纬度（启动时选择 2 使用）",
+	"lon_s1":                   "南一楼经度",
+	"ua":                       "请求使用的 User-Agent（建议填写微信内置浏览器 UA）",
+	"max_polling_attempts":     "最大轮询次数（保留项）",
+	"debug":                    "1 时默认日志级别为 debug",
+	"autoqr_mode":              "二维码签到后端：manual（手动扫码）、autohotkey（自动截图识别）或 exec（运行 autoqr_command）",
+	"autoqr_interval_ms":       "触发识别后按此间隔（毫秒）重扫当前二维码，直到收到本人结果或签到结束",
+	"autoqr_max_attempts":      "每个签到最多运行扫描后端的次数，负数不限制",
+	"autoqr_x":                 "二维码图片窗口左上角 X（像素）",
+	"autoqr_y":                 "二维码图片窗口左上角 Y（像素）",
+	"autoqr_size":              "二维码图片边长（像素）",
+	"autoqr_recognize_x":       "微信识别按钮的绝对 X，0 表示不点击",
+	"autoqr_recognize_y":       "微信识别按钮的绝对 Y，0 表示不点击",
+	"autoqr_command":           "exec 后端的命令及参数，每个参数都是模板：{{.URL}} 二维码链接，{{.PNG}} 图片路径",
+	"autoqr_ahk_version":       "AutoHotkey 脚本版本：auto（按找到的解释器判断）、v1 或 v2",
+	"autoqr_timeout_ms":        "单次 AutoHotkey 脚本或 exec 命令的最长运行时间（毫秒），超时即终止并按失败重试",
+	"autoqr_workdir":           "二维码图片与 AHK 脚本的临时目录根，每次运行在其下建独立子目录；为空使用系统临时目录下的 wzj-autoqr",
+	"qr_mode":                  "终端二维码样式：full（色块，最大）、half（半块字符，约 1/4 面积）、ascii（仅 ASCII）；终端过窄时自动改用 half",
+	"qr_level":                 "二维码纠错级别：L/M/Q/H，级别越低码越小",
+	"qr_invert":                "反色显示，浅色终端主题下使用 half/ascii 时开启",
+	"qr_quiet_zone":            "二维码四周留白（模块数），0 为默认 1，负数不留白",
+	"qr_outputs":               "二维码输出目标：terminal 或 .png/.svg 文件路径（每次刷新原子替换，如 qr/latest.png），与 autoqr_mode 无关；[] 表示不输出",
+	"qr_png_size":              "qr_outputs 中 PNG 图片的边长（像素）",
+	"ws_read_timeout_ms":       "WS 读超时（毫秒），超时未收到任何帧即重连",
+	"ws_write_timeout_ms":      "WS 单次写入超时（毫秒）",
+	"ws_ping_interval_ms":      "WS ping 间隔（毫秒），须小于读超时",
+	"ws_max_message_size":      "WS 单帧最大字节数",
+	"ws_record_file":           "非空时把 WS 收发帧写入该 JSONL 文件（可用 replay 子命令回放）",
+	"ws_discovery_file":        "记录未识别的 WS 消息（每类首条，已脱敏，JSONL），none 只在内存计数",
+	"http_cassette":            "非空时启用 HTTP cassette 录制/回放文件",
+	"http_cassette_mode":       "cassette 模式：record 或 replay",
+	"log_level":                "默认日志级别：debug/info/warn/error",
+	"log_levels":               "按子系统覆盖日志级别，如 {\"qrws\": \"debug\"}",
+	"log_format":               "日志格式：text 或 json",
+	"log_file":                 "非空时同时写入该日志文件（按大小轮转）",
+	"log_max_size_mb":          "单个日志文件上限（MB）",
+	"log_max_backups":          "保留的轮转日志个数",
+	"credential_file":          "保存已验证 openid 的文件（0600），none 关闭",
+	"credential_encrypt":       "用口令加密保存 openid（口令取自 WZJ_CRED_PASSPHRASE 或启动时输入）",
+	"openid_check_interval_ms": "定期校验 openid 的间隔（毫秒）",
+	"notify":                   "通知渠道列表（webhook/smtp/command），见 README",
+	"http_addr":                "本地状态页/API 监听地址，如 127.0.0.1:8765，为空不启用",
+	"metrics_path":             "Prometheus 指标路径（挂在 http_addr 上），none 关闭",
+	"control_token":            "非空时 /control 需要 Bearer token",
+	"config_watch_interval_ms": "检查配置文件变化的间隔（毫秒），负数关闭热加载",
+}
+
+// Template renders every field with its default value and a comment, in the format
+// chosen by the file extension (.yaml/.yml or .toml; JSON cannot hold comments).
+func Template(path string) ([]byte, error) {
+	var toml bool
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+	case ".toml":
+		toml = true
+	case ".json":
+		return nil, fmt.Errorf("JSON 不支持注释，请使用 .yaml 或 .toml 作为模板文件")
+	default:
+		return nil, fmt.Errorf("unsupported config format %q (yaml, toml)", ext)
+	}
+	def := reflect.ValueOf(Defaults()).Elem()
+	t := def.Type()
+	var b bytes.Buffer
+	b.WriteString("# wzj-assistant-autoCkeckin 配置（config init 生成）\n")
+	b.WriteString("# 每项均为默认值，可删除无需修改的项；优先级：默认值 < 本文件 < 环境变量 WZJ_<字段名大写> < 命令行 -<字段名>\n")
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		b.WriteString("\n")
+		if doc := fieldDocs[name]; doc != "" {
+			b.WriteString("# " + doc + "\n")
+		}
+		v, err := templateValue(def.Field(i), toml)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if toml {
+			fmt.Fprintf(&b, "%s = %s\n", name, v)
+		} else {
+			fmt.Fprintf(&b, "%s: %s\n", name, v)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// templateValue formats a default value. Maps are always empty by default; non-empty
+// lists only hold strings, whose JSON form is valid YAML and TOML.
+func templateValue(v reflect.Value, toml bool) (string, error) {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return "[]", nil
+		}
+		out, err := json.Marshal(v.Interface())
+		return string(out), err
+	case reflect.Map:
+		return "{}", nil
+	case reflect.Float64:
+		s := strconv.FormatFloat(v.Float(), 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, nil
+	}
+	if toml {
+		switch v.Kind() {
+		case reflect.String:
+			return strconv.Quote(v.String()), nil
+		case reflect.Int, reflect.Int64:
+			return strconv.FormatInt(v.Int(), 10), nil
+		case reflect.Bool:
+			return strconv.FormatBool(v.Bool()), nil
+		}
+		return "", fmt.Errorf("unsupported kind %s", v.Kind())
+	}
+	out, err := yaml.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
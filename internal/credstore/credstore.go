@@ -0,0 +1,154 @@
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotFound is returned by Load when nothing has been saved yet.
+var ErrNotFound = errors.New("credential not found")
+
+// ErrBadPassphrase means the file is encrypted and the passphrase does not open it.
+var ErrBadPassphrase = errors.New("credential passphrase is wrong or file is corrupted")
+
+const fileVersion = 1
+
+// kdfIter is the PBKDF2 iteration count for new files; Load uses the count stored in
+// the file. 测试中会调低以节省时间。
+var kdfIter = 600000
+
+// Store persists the openid to a 0600 file, optionally encrypted with AES-GCM
+// using a PBKDF2-SHA256 key derived from Passphrase.
+type Store struct {
+	Path       string
+	Passphrase string // 为空则明文保存
+}
+
+type fileFormat struct {
+	Version int    `json:"version"`
+	OpenID  string `json:"openid,omitempty"`
+	// 加密保存时使用以下字段
+	KDF        string `json:"kdf,omitempty"`
+	Iter       int    `json:"iter,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+// Load returns the saved openid.
+func (s *Store) Load() (string, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load credential: %w", err)
+	}
+	var ff fileFormat
+	if err := json.Unmarshal(data, &ff); err != nil {
+		return "", fmt.Errorf("failed to load credential: %w", err)
+	}
+	if ff.Version != fileVersion {
+		return "", fmt.Errorf("failed to load credential: unsupported version %d", ff.Version)
+	}
+	if len(ff.Ciphertext) == 0 {
+		if ff.OpenID == "" {
+			return "", ErrNotFound
+		}
+		return ff.OpenID, nil
+	}
+	if s.Passphrase == "" {
+		return "", fmt.Errorf("failed to load credential: file is encrypted, passphrase required")
+	}
+	gcm, err := newGCM(s.Passphrase, ff.Salt, ff.Iter)
+	if err != nil {
+		return "", err
+	}
+	if len(ff.Nonce) != gcm.NonceSize() {
+		return "", ErrBadPassphrase // Open 遇到长度不对的 nonce 会 panic
+	}
+	plain, err := gcm.Open(nil, ff.Nonce, ff.Ciphertext, nil)
+	if err != nil {
+		return "", ErrBadPassphrase
+	}
+	return string(plain), nil
+}
+
+// Save writes the openid atomically with 0600 permissions.
+func (s *Store) Save(openid string) error {
+	ff := fileFormat{Version: fileVersion}
+	if s.Passphrase == "" {
+		ff.OpenID = openid
+	} else {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		gcm, err := newGCM(s.Passphrase, salt, kdfIter)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		ff.KDF = "pbkdf2-sha256"
+		ff.Iter = kdfIter
+		ff.Salt = salt
+		ff.Nonce = nonce
+		ff.Ciphertext = gcm.Seal(nil, nonce, []byte(openid), nil)
+	}
+	data, err := json.MarshalIndent(ff, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to save credential: %w", err)
+		}
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save credential: %w", err)
+	}
+	// WriteFile 不会修改已存在文件的权限，这里显式收紧
+	if err := os.Chmod(tmp, 0600); err != nil {
+		return fmt.Errorf("failed to save credential: %w", err)
+	}
+	if err := os.Rename(tmp, s.Path); err != nil {
+		return fmt.Errorf("failed to save credential: %w", err)
+	}
+	return nil
+}
+
+// Clear removes the saved credential (used once it has been detected as invalid).
+func (s *Store) Clear() error {
+	err := os.Remove(s.Path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func newGCM(passphrase string, salt []byte, iter int) (cipher.AEAD, error) {
+	if iter <= 0 {
+		iter = kdfIter
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iter, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
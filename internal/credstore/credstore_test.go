@@ -0,0 +1,128 @@
+package credstore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testOpenID = "0123456789abcdef0123456789abcdef"
+
+func TestMain(m *testing.M) {
+	kdfIter = 1000
+	os.Exit(m.Run())
+}
+
+func TestPlainRoundTrip(t *testing.T) {
+	s := &Store{Path: filepath.Join(t.TempDir(), "cred.json")}
+	if _, err := s.Load(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("load before save: %v, want ErrNotFound", err)
+	}
+	if err := s.Save(testOpenID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Load(); err != nil || got != testOpenID {
+		t.Fatalf("Load() = %q, %v", got, err)
+	}
+	if err := s.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("load after clear: %v, want ErrNotFound", err)
+	}
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	s := &Store{Path: filepath.Join(t.TempDir(), "cred.json"), Passphrase: "correct horse"}
+	if err := s.Save(testOpenID); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), testOpenID) {
+		t.Fatal("openid stored in plain text")
+	}
+	if got, err := s.Load(); err != nil || got != testOpenID {
+		t.Fatalf("Load() = %q, %v", got, err)
+	}
+
+	// 缺少口令时报错而不是返回密文
+	if got, err := (&Store{Path: s.Path}).Load(); err == nil || got != "" {
+		t.Fatalf("load without passphrase = %q, %v", got, err)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cred.json")
+	if err := (&Store{Path: path, Passphrase: "right"}).Save(testOpenID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := (&Store{Path: path, Passphrase: "wrong"}).Load()
+	if !errors.Is(err, ErrBadPassphrase) || got != "" {
+		t.Fatalf("Load() = %q, %v; want ErrBadPassphrase", got, err)
+	}
+}
+
+func TestTamperedFileRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(ff *fileFormat)
+	}{
+		{"ciphertext", func(ff *fileFormat) { ff.Ciphertext[0] ^= 1 }},
+		{"auth tag", func(ff *fileFormat) { ff.Ciphertext[len(ff.Ciphertext)-1] ^= 0x80 }},
+		{"nonce", func(ff *fileFormat) { ff.Nonce[0] ^= 1 }},
+		{"short nonce", func(ff *fileFormat) { ff.Nonce = ff.Nonce[:4] }},
+		{"salt", func(ff *fileFormat) { ff.Salt[0] ^= 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Store{Path: filepath.Join(t.TempDir(), "cred.json"), Passphrase: "pass"}
+			if err := s.Save(testOpenID); err != nil {
+				t.Fatal(err)
+			}
+			data, _ := os.ReadFile(s.Path)
+			var ff fileFormat
+			if err := json.Unmarshal(data, &ff); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(&ff)
+			data, _ = json.Marshal(ff)
+			if err := os.WriteFile(s.Path, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Load()
+			if !errors.Is(err, ErrBadPassphrase) || got != "" {
+				t.Fatalf("Load() = %q, %v; want ErrBadPassphrase", got, err)
+			}
+		})
+	}
+}
+
+func TestSaveFileMode(t *testing.T) {
+	dir := t.TempDir()
+	for _, pass := range []string{"", "pass"} {
+		path := filepath.Join(dir, "sub", "cred-"+pass+".json")
+		// 已存在且权限过宽的文件也要被收紧
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := (&Store{Path: path, Passphrase: pass}).Save(testOpenID); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := fi.Mode().Perm(); mode != 0600 {
+			t.Fatalf("passphrase %q: mode = %o, want 600", pass, mode)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event kinds published by the orchestrator and qrws.
+const (
+	SignDetected   = "sign_detected"
+	SignSucceeded  = "sign_succeeded"
+	SignFailed     = "sign_failed"
+	QRResult       = "qr_result"
+	OpenIDExpired  = "openid_expired"
+	OpenIDRenewed  = "openid_renewed"
+	WSConnected    = "ws_connected"
+	WSDisconnected = "ws_disconnected"
+	AutoQRFailed   = "autoqr_failed"
+	QRRefreshed    = "qr_refreshed"
+	WSUnknown      = "ws_unknown"
+)
+
+// Frequent kinds are published many times per sign; notification sinks only receive
+// them when listed explicitly.
+var Frequent = map[string]bool{
+	QRRefreshed: true,
+}
+
+// Event is one occurrence with free-form fields (courseId, signId, name, error, ...).
+type Event struct {
+	Kind   string         `json:"kind"`
+	Time   time.Time      `json:"time"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// Bus fans events out to subscribers. Publishing never blocks: a subscriber whose
+// buffer is full misses the event. A nil *Bus discards everything.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[chan Event]struct{}{}}
+}
+
+// Publish sends an event to every subscriber.
+func (b *Bus) Publish(kind string, fields map[string]any) {
+	if b == nil {
+		return
+	}
+	ev := Event{Kind: kind, Time: time.Now(), Fields: fields}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a buffered channel of events and a function that unsubscribes
+// and closes it.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
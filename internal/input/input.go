@@ -5,28 +5,60 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"regexp"
 	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+var (
+	linesOnce sync.Once
+	lines     chan string
 )
-var openidParamRe = regexp.MustCompile(`(?i)(?:[?&]openid=)([^&]+)`)
 
-func GetOpenid() (string,error) {
+// Lines returns stdin line by line from a single reader goroutine that lives for the whole
+// process, so prompts that come and go (openid renewal) never compete for input.
+// 首次调用后所有标准输入都应经由它读取；读到 EOF 或出错时关闭通道。
+func Lines() <-chan string {
+	linesOnce.Do(func() {
+		lines = make(chan string)
+		go func() {
+			defer close(lines)
+			sc := bufio.NewScanner(os.Stdin)
+			for sc.Scan() {
+				lines <- sc.Text()
+			}
+		}()
+	})
+	return lines
+}
+
+// PromptOpenid prints the openid prompt.
+func PromptOpenid() {
 	fmt.Println("input url or openid: ")
-	text,err:=bufio.NewReader(os.Stdin).ReadString('\n')
-	if(err != nil &&err != io.EOF) {
-		return "",err
-	}
-	text = strings.TrimSpace(text)
-	if text == ""{
-		return "",fmt.Errorf("your input is nil")
-	}
-	if len(text) == 32 {
-		return text,nil
+}
+
+func GetOpenid() (string, error) {
+	PromptOpenid()
+	text, ok := <-Lines()
+	if !ok {
+		return "", io.EOF
 	}
-	if m:=openidParamRe.FindStringSubmatch(text);len(m) == 2 {
-		return m[1],nil
-	} else {
-		return "",fmt.Errorf("can't get openid from your input")
-	} 
+	return ExtractOpenid(text)
+}
 
-}
\ No newline at end of file
+// GetPassphrase prompts for a passphrase without echo when stdin is a terminal.
+func GetPassphrase(prompt string) string {
+	fmt.Print(prompt)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(b))
+	}
+	// 非终端（管道）时与 openid 共用同一个读取协程，避免另建缓冲读走后续输入
+	text := <-Lines()
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,40 @@
+package input
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// 管道输入时口令与 openid 依次读取，口令不能多读走后面的行
+func TestPipedPassphraseThenOpenid(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() { os.Stdin = stdin })
+
+	if _, err := w.WriteString("secret pass\nhttps://v18.teachermate.cn/sign?openid=" + sampleID + "\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := GetPassphrase(""); got != "secret pass" {
+		t.Fatalf("passphrase = %q", got)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		got, err := GetOpenid()
+		if err != nil || got != sampleID {
+			t.Errorf("GetOpenid() = %q, %v", got, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("openid prompt hung after reading the passphrase")
+	}
+	w.Close()
+}
@@ -0,0 +1,133 @@
+package input
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// OpenIDLength is the length of a Teachermate openid.
+const OpenIDLength = 32
+
+var (
+	ErrEmptyInput     = errors.New("your input is nil")
+	ErrOpenIDNotFound = errors.New("can't get openid from your input")
+	ErrInvalidOpenID  = errors.New("openid must be 32 characters of [0-9A-Za-z_-]")
+)
+
+// maxDepth bounds nested URL / percent-encoding unwrapping.
+const maxDepth = 5
+
+// ExtractOpenid finds the openid in user input: a bare openid, or a URL carrying it in the
+// query, in a fragment route (#/...?openid=), or inside a nested (percent-encoded)
+// redirect URL. Surrounding whitespace and quotes are ignored.
+func ExtractOpenid(text string) (string, error) {
+	text = trimInput(text)
+	if text == "" {
+		return "", ErrEmptyInput
+	}
+	if ValidOpenID(text) {
+		return text, nil
+	}
+	if id, ok := findOpenID(text, 0); ok {
+		return id, nil
+	}
+	// 形似 openid 但字符集/长度不符时给出更明确的提示
+	if !strings.ContainsAny(text, "/?&=#%") && len(text) >= OpenIDLength-4 && len(text) <= OpenIDLength+4 {
+		return "", ErrInvalidOpenID
+	}
+	return "", ErrOpenIDNotFound
+}
+
+// ValidOpenID checks length and character set.
+func ValidOpenID(s string) bool {
+	if len(s) != OpenIDLength {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func trimInput(s string) string {
+	// 去掉首尾空白、引号、尖括号（聊天软件复制常带这些）
+	return strings.TrimFunc(s, func(r rune) bool {
+		switch r {
+		case ' ', '\t', '\r', '\n', '"', '\'', '`', '<', '>', '“', '”', '‘', '’', ' ', '　':
+			return true
+		}
+		return false
+	})
+}
+
+func findOpenID(s string, depth int) (string, bool) {
+	if depth > maxDepth || s == "" {
+		return "", false
+	}
+	if id, ok := fromQuery(queryPart(s), depth); ok {
+		return id, true
+	}
+	// 片段路由：https://host/#/sign?openid=...
+	if i := strings.Index(s, "#"); i >= 0 {
+		if id, ok := findOpenID(s[i+1:], depth+1); ok {
+			return id, true
+		}
+	}
+	// 整体被百分号编码（如作为参数复制出来的链接）
+	if dec, err := url.QueryUnescape(s); err == nil && dec != s {
+		return findOpenID(dec, depth+1)
+	}
+	return "", false
+}
+
+// queryPart returns the part after '?' (without fragment), or s itself when it already
+// looks like a bare "k=v&k2=v2" query.
+func queryPart(s string) string {
+	if i := strings.Index(s, "?"); i >= 0 {
+		s = s[i+1:]
+	} else if !strings.Contains(s, "=") {
+		return ""
+	}
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+func fromQuery(q string, depth int) (string, bool) {
+	if q == "" {
+		return "", false
+	}
+	values, err := url.ParseQuery(q)
+	if err != nil && len(values) == 0 {
+		return "", false
+	}
+	for k, vs := range values {
+		if !strings.EqualFold(k, "openid") {
+			continue
+		}
+		for _, v := range vs {
+			v = trimInput(v)
+			if ValidOpenID(v) {
+				return v, true
+			}
+		}
+	}
+	// 嵌套的重定向链接：redirect_uri=https%3A%2F%2F...%3Fopenid%3D...
+	for _, vs := range values {
+		for _, v := range vs {
+			if strings.ContainsAny(v, "?=#%") {
+				if id, ok := findOpenID(v, depth+1); ok {
+					return id, true
+				}
+			}
+		}
+	}
+	return "", false
+}
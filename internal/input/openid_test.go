@@ -0,0 +1,94 @@
+package input
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const sampleID = "oAbC_12-xyZ9876543210ABCdefGHIjk"
+
+func TestExtractOpenid(t *testing.T) {
+	nested := "https://open.weixin.qq.com/connect/oauth2/authorize?appid=wx1&redirect_uri=" +
+		url.QueryEscape("https://v18.teachermate.cn/wechat-pro-ssr/student/sign?openid="+sampleID) +
+		"&response_type=code#wechat_redirect"
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   error
+	}{
+		{"bare", sampleID, sampleID, nil},
+		{"quoted with whitespace", " \t“" + sampleID + "”\n", sampleID, nil},
+		{"single quotes", "'" + sampleID + "'", sampleID, nil},
+		{"query", "https://v18.teachermate.cn/wechat-pro-ssr/student/sign?openid=" + sampleID + "&from=menu", sampleID, nil},
+		{"bare query", "foo=1&openid=" + sampleID, sampleID, nil},
+		{"fragment route", "https://v18.teachermate.cn/wechat-pro/#/student/sign?openid=" + sampleID, sampleID, nil},
+		{"nested redirect_uri", nested, sampleID, nil},
+		{"fully encoded url", url.QueryEscape("https://v18.teachermate.cn/sign?openid=" + sampleID), sampleID, nil},
+		{"uppercase key", "https://v18.teachermate.cn/sign?OPENID=" + sampleID, sampleID, nil},
+		{"bad percent escape", "https://v18.teachermate.cn/sign?openid=" + sampleID + "&x=%zz", sampleID, nil},
+		{"empty", "  ", "", ErrEmptyInput},
+		{"length 31", sampleID[:31], "", ErrInvalidOpenID},
+		{"length 33", sampleID + "a", "", ErrInvalidOpenID},
+		{"wrong charset", sampleID[:31] + "!", "", ErrInvalidOpenID},
+		{"url without openid", "https://v18.teachermate.cn/sign?course=1", "", ErrOpenIDNotFound},
+		{"query with short openid", "https://v18.teachermate.cn/sign?openid=" + sampleID[:20], "", ErrOpenIDNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractOpenid(tt.input)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Fatalf("ExtractOpenid(%q) = %q, %v; want %q, %v", tt.input, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidOpenID(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{sampleID, true},
+		{strings.Repeat("a", 32), true},
+		{strings.Repeat("a", 31), false},
+		{strings.Repeat("a", 33), false},
+		{strings.Repeat("a", 31) + ".", false},
+		{strings.Repeat("a", 31) + "=", false},
+		{strings.Repeat("中", 8) + strings.Repeat("a", 8), false}, // 32 字节但不是 ASCII
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidOpenID(tt.in); got != tt.want {
+			t.Errorf("ValidOpenID(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func FuzzExtractOpenid(f *testing.F) {
+	for _, s := range []string{
+		sampleID,
+		"“" + sampleID + "”",
+		"https://v18.teachermate.cn/sign?openid=" + sampleID,
+		"https://v18.teachermate.cn/#/sign?openid=" + sampleID,
+		"https://x/?redirect_uri=" + url.QueryEscape("https://y/?openid="+sampleID),
+		"%25%25%zz?openid=&#",
+		"",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		got, err := ExtractOpenid(s)
+		if err != nil {
+			if got != "" {
+				t.Fatalf("ExtractOpenid(%q) returned %q with error %v", s, got, err)
+			}
+			return
+		}
+		if !ValidOpenID(got) {
+			t.Fatalf("ExtractOpenid(%q) = %q, which is not a valid openid", s, got)
+		}
+	})
+}
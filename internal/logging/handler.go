@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// subsystemHandler applies a per-subsystem level in front of the shared handler.
+type subsystemHandler struct {
+	inner slog.Handler
+	level *slog.LevelVar
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &subsystemHandler{inner: h.inner.WithAttrs(attrs), level: h.level}
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return &subsystemHandler{inner: h.inner.WithGroup(name), level: h.level}
+}
+
+// textHandler keeps the console format the tool always had:
+//
+//	[2006-01-02 15:04:05.000] INFO  [qrws] message key=value ...
+type textHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	sys    string
+	prefix string // 预先格式化的 attrs（WithAttrs）
+	group  string
+}
+
+func newTextHandler(w io.Writer) *textHandler {
+	return &textHandler{mu: &sync.Mutex{}, w: w}
+}
+
+func (h *textHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	buf.WriteString("[" + t.Format("2006-01-02 15:04:05.000") + "] ")
+	fmt.Fprintf(&buf, "%-5s ", r.Level.String())
+	if h.sys != "" {
+		buf.WriteString("[" + h.sys + "] ")
+	}
+	buf.WriteString(r.Message)
+	buf.WriteString(h.prefix)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&buf, h.group, a)
+		return true
+	})
+	buf.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := *h
+	var buf bytes.Buffer
+	for _, a := range attrs {
+		// 子系统名单独显示在前缀中
+		if a.Key == "sys" && h.group == "" {
+			nh.sys = a.Value.String()
+			continue
+		}
+		appendAttr(&buf, h.group, a)
+	}
+	nh.prefix = h.prefix + buf.String()
+	return &nh
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	nh := *h
+	if nh.group != "" {
+		nh.group += "."
+	}
+	nh.group += name
+	return &nh
+}
+
+func appendAttr(buf *bytes.Buffer, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	key := a.Key
+	if group != "" {
+		key = group + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			appendAttr(buf, key, ga)
+		}
+		return
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	var s string
+	switch a.Value.Kind() {
+	case slog.KindTime:
+		s = a.Value.Time().Format(time.RFC3339Nano)
+	default:
+		s = a.Value.String()
+	}
+	if needsQuote(s) {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r == ' ' || r == '"' || r == '=' || r < 0x20 {
+			return true
+		}
+	}
+	return false
+}
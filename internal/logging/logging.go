@@ -0,0 +1,186 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Options configures the shared logger.
+type Options struct {
+	Level      string            // 默认级别：debug/info/warn/error
+	Levels     map[string]string // 按子系统覆盖级别，如 {"qrws": "debug"}
+	Format     string            // "text"（默认）或 "json"
+	File       string            // 非空时同时写入该文件（按大小轮转）
+	MaxSizeMB  int               // 单个日志文件上限，默认 10
+	MaxBackups int               // 保留的历史文件个数，默认 3
+	// Redact 非空时作用于全部输出（控制台与文件），用于遮蔽 openid 等标识
+	Redact func(string) string
+}
+
+// Manager owns the output handler and per-subsystem levels; Logger hands out
+// *slog.Logger values that share them, so levels can be changed at runtime.
+type Manager struct {
+	handler slog.Handler
+	file    *rotatingFile
+
+	mu        sync.Mutex
+	def       *slog.LevelVar
+	levels    map[string]*slog.LevelVar // 每个子系统一个，Logger 与 SetLevel 共用同一指针
+	overrides map[string]bool           // 显式设置过级别的子系统，不随默认级别变化
+}
+
+// New builds the manager writing to stdout (and the optional rotating file).
+func New(opts Options) (*Manager, error) {
+	return NewWithWriter(opts, os.Stdout)
+}
+
+// NewWithWriter is New with a custom console writer.
+func NewWithWriter(opts Options, console io.Writer) (*Manager, error) {
+	m := &Manager{def: new(slog.LevelVar), levels: map[string]*slog.LevelVar{}, overrides: map[string]bool{}}
+	lvl, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	m.def.Set(lvl)
+	for sub, s := range opts.Levels {
+		l, err := ParseLevel(s)
+		if err != nil {
+			return nil, fmt.Errorf("log level for %s: %w", sub, err)
+		}
+		v := new(slog.LevelVar)
+		v.Set(l)
+		m.levels[sub] = v
+		m.overrides[sub] = true
+	}
+
+	w := console
+	if opts.File != "" {
+		f, err := openRotating(opts.File, opts.MaxSizeMB, opts.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		m.file = f
+		w = io.MultiWriter(console, f)
+	}
+	if opts.Redact != nil {
+		w = &redactWriter{w: w, fn: opts.Redact}
+	}
+	// 级别过滤由 subsystemHandler 负责，底层 handler 放行全部级别
+	hopts := &slog.HandlerOptions{Level: slog.Level(-100)}
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		m.handler = newTextHandler(w)
+	case "json":
+		m.handler = slog.NewJSONHandler(w, hopts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (text/json)", opts.Format)
+	}
+	return m, nil
+}
+
+// Logger returns the logger for a subsystem ("main", "qrws", "requests", "autoqr", ...).
+func (m *Manager) Logger(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{
+		inner: m.handler.WithAttrs([]slog.Attr{slog.String("sys", subsystem)}),
+		level: m.levelVar(subsystem),
+	})
+}
+
+func (m *Manager) levelVar(subsystem string) *slog.LevelVar {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.levelVarLocked(subsystem)
+}
+
+// levelVarLocked returns the subsystem's LevelVar, creating it from the default level
+// on first use so loggers handed out earlier see every later SetLevel.
+func (m *Manager) levelVarLocked(subsystem string) *slog.LevelVar {
+	v, ok := m.levels[subsystem]
+	if !ok {
+		v = new(slog.LevelVar)
+		v.Set(m.def.Level())
+		m.levels[subsystem] = v
+	}
+	return v
+}
+
+// SetLevel changes the level of one subsystem; an empty subsystem changes the default
+// level shared by every subsystem without an explicit override.
+func (m *Manager) SetLevel(subsystem string, level slog.Level) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if subsystem == "" {
+		m.def.Set(level)
+		for sub, v := range m.levels {
+			if !m.overrides[sub] {
+				v.Set(level)
+			}
+		}
+		return
+	}
+	m.overrides[subsystem] = true
+	m.levelVarLocked(subsystem).Set(level)
+}
+
+// ResetLevel drops a subsystem's override so it follows the default level again.
+func (m *Manager) ResetLevel(subsystem string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.overrides, subsystem)
+	if v, ok := m.levels[subsystem]; ok {
+		v.Set(m.def.Level())
+	}
+}
+
+// Level reports the effective level of a subsystem ("" for the default).
+func (m *Manager) Level(subsystem string) slog.Level {
+	if subsystem == "" {
+		return m.def.Level()
+	}
+	return m.levelVar(subsystem).Level()
+}
+
+// Close flushes and closes the log file, if any.
+func (m *Manager) Close() error {
+	if m.file == nil {
+		return nil
+	}
+	return m.file.Close()
+}
+
+// redactWriter applies the redaction function to every formatted record.
+type redactWriter struct {
+	w  io.Writer
+	fn func(string) string
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, r.fn(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ParseLevel accepts debug/info/warn/error (case-insensitive); empty means info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// Discard returns a logger that drops everything; used when no logger is injected.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
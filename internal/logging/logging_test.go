@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func newTestManager(t *testing.T, opts Options) (*Manager, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	m, err := NewWithWriter(opts, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, &buf
+}
+
+func TestSetLevelAfterLoggerCreated(t *testing.T) {
+	m, buf := newTestManager(t, Options{})
+	l := m.Logger("qrws")
+
+	l.Debug("before")
+	m.SetLevel("qrws", slog.LevelDebug)
+	l.Debug("after")
+
+	out := buf.String()
+	if strings.Contains(out, "before") {
+		t.Fatalf("debug logged at info level: %q", out)
+	}
+	if !strings.Contains(out, "after") {
+		t.Fatalf("SetLevel did not reach an existing logger: %q", out)
+	}
+}
+
+func TestDefaultLevelAndOverrides(t *testing.T) {
+	m, buf := newTestManager(t, Options{Levels: map[string]string{"autoqr": "warn"}})
+	qrws, autoqr := m.Logger("qrws"), m.Logger("autoqr")
+
+	// 默认级别只影响没有显式覆盖的子系统
+	m.SetLevel("", slog.LevelDebug)
+	qrws.Debug("qrws-debug")
+	autoqr.Info("autoqr-info")
+	if out := buf.String(); !strings.Contains(out, "qrws-debug") || strings.Contains(out, "autoqr-info") {
+		t.Fatalf("output = %q", out)
+	}
+
+	// 去掉覆盖后跟随默认级别
+	buf.Reset()
+	m.ResetLevel("autoqr")
+	autoqr.Debug("autoqr-debug")
+	if !strings.Contains(buf.String(), "autoqr-debug") {
+		t.Fatalf("reset subsystem did not follow the default: %q", buf.String())
+	}
+	if got := m.Level("autoqr"); got != slog.LevelDebug {
+		t.Fatalf("Level(autoqr) = %v", got)
+	}
+
+	// 覆盖后再改默认级别不影响它
+	m.SetLevel("qrws", slog.LevelError)
+	m.SetLevel("", slog.LevelInfo)
+	if got := m.Level("qrws"); got != slog.LevelError {
+		t.Fatalf("Level(qrws) = %v, want error", got)
+	}
+}
@@ -0,0 +1,239 @@
+// Package metrics keeps process-wide counters, gauges and histograms and writes them
+// in the Prometheus text exposition format. 只实现本项目需要的最小子集，不依赖 client_golang。
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is one registered family.
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	regMu    sync.Mutex
+	registry []metric
+)
+
+func register(m metric) {
+	regMu.Lock()
+	registry = append(registry, m)
+	regMu.Unlock()
+}
+
+// vec stores one value per label combination.
+type vec[T any] struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]*T
+	labelVals  map[string][]string // key -> 原始标签值
+}
+
+func (v *vec[T]) get(labelValues []string, init func() *T) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	// 逐个加引号再拼接：任意字节的标签值都不会与分隔符混淆
+	key := fmt.Sprintf("%q", labelValues)
+	p, ok := v.values[key]
+	if !ok {
+		p = init()
+		v.values[key] = p
+		if v.labelVals == nil {
+			v.labelVals = map[string][]string{}
+		}
+		v.labelVals[key] = append([]string(nil), labelValues...)
+	}
+	return p
+}
+
+// sortedKeys returns label combinations in a stable order for output.
+func (v *vec[T]) sortedKeys() []string {
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec[T]) header(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, helpEscaper.Replace(v.help), v.name, typ)
+}
+
+// labelString renders {a="x",b="y"}; extra is appended as-is (used for le).
+func (v *vec[T]) labelString(key string, extra string) string {
+	var parts []string
+	for i, val := range v.labelVals[key] {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, v.labels[i], escape(val)))
+	}
+	if extra != "" {
+		parts = append(parts, extra)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// HELP 文本只转义反斜杠与换行，引号原样保留
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// escape quotes a label value as the exposition format requires.
+func escape(s string) string {
+	return labelEscaper.Replace(strings.ToValidUTF8(s, "?"))
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value per label combination.
+type Counter struct {
+	vec[float64]
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec[float64]{name: name, help: help, labels: labels, values: map[string]*float64{}}}
+	register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.get(labelValues, func() *float64 { return new(float64) }) += delta
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+	for _, k := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(k, ""), formatFloat(*c.values[k]))
+	}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	vec[float64]
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec[float64]{name: name, help: help, labels: labels, values: map[string]*float64{}}}
+	register(g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.get(labelValues, func() *float64 { return new(float64) }) = v
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.header(w, "gauge")
+	if len(g.labels) == 0 && len(g.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", g.name)
+	}
+	for _, k := range g.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelString(k, ""), formatFloat(*g.values[k]))
+	}
+}
+
+type histogramValue struct {
+	counts []uint64 // 与 buckets 一一对应（非累计）
+	count  uint64
+	sum    float64
+}
+
+// Histogram counts observations into fixed upper-bound buckets.
+type Histogram struct {
+	vec[histogramValue]
+	buckets []float64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	h := &Histogram{vec: vec[histogramValue]{name: name, help: help, labels: labels, values: map[string]*histogramValue{}}, buckets: b}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv := h.get(labelValues, func() *histogramValue {
+		return &histogramValue{counts: make([]uint64, len(h.buckets))}
+	})
+	for i, ub := range h.buckets {
+		if v <= ub {
+			hv.counts[i]++
+			break
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, k := range h.sortedKeys() {
+		hv := h.values[k]
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += hv.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(k, `le="`+formatFloat(ub)+`"`), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(k, `le="+Inf"`), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(k, ""), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(k, ""), hv.count)
+	}
+}
+
+// Write outputs every registered metric in text exposition format.
+func Write(w io.Writer) {
+	regMu.Lock()
+	ms := append([]metric(nil), registry...)
+	regMu.Unlock()
+	for _, m := range ms {
+		m.write(w)
+	}
+}
+
+// Handler serves the registry for Prometheus scrapes.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden from the current output")
+
+func TestExpositionGolden(t *testing.T) {
+	plain := NewCounter("test_plain_total", "A counter without labels that was never incremented.")
+	requests := NewCounter("test_requests_total", "Requests by \"path\" and code.\nSecond line with a \\ backslash.", "path", "code")
+	requests.Inc("/a", "200")
+	requests.Add(2.5, "/a", "500")
+	requests.Inc(`C:\tmp "quoted"`+"\nnext", "200")
+	requests.Inc("bad\xffutf8", "200")
+	conn := NewGauge("test_connected", "1 while connected.")
+	temp := NewGauge("test_temperature", "Temperature by room.", "room")
+	temp.Set(-3.25, "lab")
+	temp.Set(1e21, "sun")
+	lat := NewHistogram("test_latency_seconds", "Latency.", []float64{1, 0.1, 0.5}, "op")
+	for _, v := range []float64{0.05, 0.2, 0.2, 0.7, 3} {
+		lat.Observe(v, "get")
+	}
+
+	var buf bytes.Buffer
+	for _, m := range []metric{plain, requests, conn, temp, lat} {
+		m.write(&buf)
+	}
+	checkExposition(t, buf.String())
+
+	golden := filepath.Join("testdata", "exposition.golden")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Fatalf("exposition differs from %s (run with -update to accept):\n%s", golden, got)
+	}
+}
+
+// 默认注册的全部指标经 HTTP 输出后同样要符合格式
+func TestHandlerOutputIsWellFormed(t *testing.T) {
+	Polls.Inc()
+	PollErrors.Inc("http")
+	WSConnected.Set(1)
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type = %q", ct)
+	}
+	out := rec.Body.String()
+	checkExposition(t, out)
+	for _, want := range []string{"wzj_polls_total 1\n", `wzj_poll_errors_total{type="http"} 1` + "\n", "wzj_ws_connected 1\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+var (
+	helpLine   = regexp.MustCompile(`^# HELP ([a-zA-Z_:][a-zA-Z0-9_:]*) ((?:[^\\\n]|\\\\|\\n)*)$`)
+	typeLine   = regexp.MustCompile(`^# TYPE ([a-zA-Z_:][a-zA-Z0-9_:]*) (counter|gauge|histogram)$`)
+	sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\["\\n])*"(?:,[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\["\\n])*")*\})? (\S+)$`)
+	sampleVal  = regexp.MustCompile(`^(?:[-+]?(?:\d+\.?\d*(?:e[-+]?\d+)?|Inf)|NaN)$`)
+)
+
+// checkExposition is a small validator for the subset of the text format we emit: every
+// family has HELP then TYPE, and every sample belongs to the family declared above it.
+func checkExposition(t *testing.T, out string) {
+	t.Helper()
+	if !strings.HasSuffix(out, "\n") {
+		t.Fatal("output does not end with a newline")
+	}
+	var family, typ string
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			m := helpLine.FindStringSubmatch(line)
+			if m == nil {
+				t.Fatalf("line %d: malformed HELP: %q", n, line)
+			}
+			if seen[m[1]] {
+				t.Fatalf("line %d: family %s declared twice", n, m[1])
+			}
+			seen[m[1]] = true
+			family, typ = m[1], ""
+		case strings.HasPrefix(line, "# TYPE "):
+			m := typeLine.FindStringSubmatch(line)
+			if m == nil || m[1] != family || typ != "" {
+				t.Fatalf("line %d: TYPE does not follow its HELP: %q", n, line)
+			}
+			typ = m[2]
+		default:
+			m := sampleLine.FindStringSubmatch(line)
+			if m == nil {
+				t.Fatalf("line %d: malformed sample: %q", n, line)
+			}
+			if !sampleVal.MatchString(m[3]) {
+				t.Fatalf("line %d: bad value %q", n, m[3])
+			}
+			name := m[1]
+			if typ == "histogram" {
+				name = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count")
+			}
+			if name != family || typ == "" {
+				t.Fatalf("line %d: sample %s outside its family %s", n, m[1], family)
+			}
+		}
+	}
+}
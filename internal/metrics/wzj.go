@@ -0,0 +1,33 @@
+package metrics
+
+// 本项目暴露的全部指标；各子系统直接调用对应变量。
+var (
+	Polls = NewCounter("wzj_polls_total",
+		"ActiveSigns polls performed.")
+	PollErrors = NewCounter("wzj_poll_errors_total",
+		"Failed ActiveSigns polls by error type.", "type")
+	SignsDetected = NewCounter("wzj_signs_detected_total",
+		"Distinct signs detected by sign type (gps/qr/normal).", "type")
+	SignInResults = NewCounter("wzj_signin_results_total",
+		"Sign-in outcomes by sign type and errorCode (\"error\" when the request failed).", "type", "code")
+	WSReconnects = NewCounter("wzj_ws_reconnects_total",
+		"WebSocket reconnects after a lost connection.")
+	WSRehandshakes = NewCounter("wzj_ws_rehandshakes_total",
+		"Bayeux re-handshakes requested by server advice.")
+	QRRefreshes = NewCounter("wzj_qr_refreshes_total",
+		"QR code URLs (type=1) received.")
+	AutoQRRuns = NewCounter("wzj_autoqr_runs_total",
+		"Scanner backend runs by mode and outcome (ok/failed).", "mode", "outcome")
+	QRAnomalies = NewCounter("wzj_qr_anomalies_total",
+		"Unusual type=1 pushes by kind (duplicate/out_of_order/gap).", "anomaly")
+	WSUnknownMessages = NewCounter("wzj_ws_unknown_messages_total",
+		"WS messages the client could not handle, by reason (unknown_channel/unknown_type/missing_field).", "reason")
+	WSConnected = NewGauge("wzj_ws_connected",
+		"1 while the WebSocket is connected (/meta/connect succeeded).")
+	HTTPDuration = NewHistogram("wzj_http_request_duration_seconds",
+		"Latency of Teachermate API requests.",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20}, "method", "path", "status")
+	SignLatency = NewHistogram("wzj_sign_latency_seconds",
+		"Time from detecting a sign to its result (sign-in response or QR type=3).",
+		[]float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300}, "type")
+)
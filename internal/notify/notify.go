@@ -0,0 +1,247 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+)
+
+// Message is what a sink delivers: rendered title/body plus the raw event.
+type Message struct {
+	Event  string         `json:"event"`
+	Title  string         `json:"title"`
+	Body   string         `json:"body"`
+	Time   time.Time      `json:"time"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// SinkOptions configures one notification channel; main builds them from the config.
+type SinkOptions struct {
+	Type     string            // "webhook" / "smtp" / "command"
+	Events   []string          // 只发送这些事件，空表示全部
+	Title    string            // 标题模板（text/template，可用 .Event .Fields .Time）
+	Template string            // 正文模板
+	URL      string            // webhook
+	Headers  map[string]string // webhook 额外请求头
+	SMTPAddr string
+	Username string
+	Password string
+	From     string
+	To       []string
+	Command  []string // 命令及参数，每个参数都是模板
+}
+
+// Notifier is a notification sink.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, msg Message) error
+}
+
+// 默认模板：可在配置中按 sink 覆盖 title/template
+var defaultTitles = map[string]string{
+	events.SignDetected:   "检测到签到",
+	events.SignSucceeded:  "签到成功",
+	events.SignFailed:     "签到失败",
+	events.QRResult:       "二维码签到结果",
+	events.OpenIDExpired:  "openid 已失效",
+	events.OpenIDRenewed:  "openid 已更新",
+	events.WSConnected:    "WS 已连接",
+	events.WSDisconnected: "WS 连接断开",
+	events.AutoQRFailed:   "自动扫码失败",
+	events.QRRefreshed:    "二维码已刷新",
+	events.WSUnknown:      "收到未识别的 WS 消息",
+}
+
+// 默认正文模板在包初始化时解析一次
+var defaultBodies = mustParseAll(map[string]string{
+	events.SignDetected:   `{{.Fields.name}} courseId={{.Fields.courseId}} signId={{.Fields.signId}} 类型={{.Fields.type}}`,
+	events.SignSucceeded:  `{{.Fields.name}} ({{.Fields.type}}) signId={{.Fields.signId}}`,
+	events.SignFailed:     `{{.Fields.name}} ({{.Fields.type}}) signId={{.Fields.signId}} 错误: {{.Fields.error}}{{.Fields.errorCode}}`,
+	events.QRResult:       `{{.Fields.name}} 排名 {{.Fields.rank}} signId={{.Fields.signId}}`,
+	events.OpenIDExpired:  `openid 已失效，轮询已暂停，请尽快提供新的 openid。原因: {{.Fields.error}}`,
+	events.OpenIDRenewed:  `已使用新的 openid 恢复轮询`,
+	events.WSConnected:    `clientId={{.Fields.clientId}}`,
+	events.WSDisconnected: `二维码通道连接中断，正在重连: {{.Fields.error}}`,
+	events.QRRefreshed:    `signId={{.Fields.signId}} hash={{.Fields.hash}} 间隔 {{.Fields.intervalMs}}ms {{.Fields.anomaly}}`,
+	events.WSUnknown:      `{{.Fields.reason}} channel={{.Fields.channel}} type={{.Fields.type}} keys={{.Fields.keys}}`,
+	events.AutoQRFailed:   `{{.Fields.mode}} signId={{.Fields.signId}} 第 {{.Fields.failures}} 次失败（可重试: {{.Fields.retryable}}）: {{.Fields.error}}`,
+})
+
+type sink struct {
+	n      Notifier
+	events map[string]bool // 为空表示全部事件
+	title  *template.Template
+	body   *template.Template
+}
+
+// Dispatcher renders events with per-sink templates and fans them out to sinks.
+type Dispatcher struct {
+	sinks   []sink
+	log     *slog.Logger
+	redact  func(string) string
+	timeout time.Duration
+	wg      sync.WaitGroup // 在途通知
+}
+
+// NewDispatcher builds the sinks and parses their templates, so a bad template fails at
+// startup. redact (optional) is applied to rendered text so identifiers do not leak to
+// external services.
+func NewDispatcher(cfgs []SinkOptions, log *slog.Logger, redact func(string) string) (*Dispatcher, error) {
+	if log == nil {
+		log = logging.Discard()
+	}
+	d := &Dispatcher{log: log, redact: redact, timeout: 15 * time.Second}
+	for i, c := range cfgs {
+		n, err := newNotifier(c)
+		if err != nil {
+			return nil, fmt.Errorf("notify[%d]: %w", i, err)
+		}
+		s := sink{n: n, events: map[string]bool{}}
+		for _, e := range c.Events {
+			s.events[e] = true
+		}
+		if c.Title != "" {
+			if s.title, err = parseTemplate("title", c.Title); err != nil {
+				return nil, fmt.Errorf("notify[%d] title: %w", i, err)
+			}
+		}
+		if c.Template != "" {
+			if s.body, err = parseTemplate("body", c.Template); err != nil {
+				return nil, fmt.Errorf("notify[%d] template: %w", i, err)
+			}
+		}
+		d.sinks = append(d.sinks, s)
+	}
+	return d, nil
+}
+
+func newNotifier(c SinkOptions) (Notifier, error) {
+	switch c.Type {
+	case "webhook":
+		return NewWebhook(c)
+	case "smtp", "email":
+		return NewSMTP(c)
+	case "command":
+		return NewCommand(c)
+	}
+	return nil, fmt.Errorf("unknown notify type %q (webhook/smtp/command)", c.Type)
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Parse(text)
+}
+
+func mustParseAll(texts map[string]string) map[string]*template.Template {
+	out := make(map[string]*template.Template, len(texts))
+	for kind, text := range texts {
+		out[kind] = template.Must(parseTemplate(kind, text))
+	}
+	return out
+}
+
+// Len reports the number of configured sinks.
+func (d *Dispatcher) Len() int { return len(d.sinks) }
+
+// Run consumes events until ch is closed or ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, ch <-chan events.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			d.Dispatch(ctx, ev)
+		}
+	}
+}
+
+// Dispatch delivers one event to every sink subscribed to it; sinks run concurrently.
+func (d *Dispatcher) Dispatch(ctx context.Context, ev events.Event) {
+	for _, s := range d.sinks {
+		if len(s.events) > 0 && !s.events[ev.Kind] {
+			continue
+		}
+		if len(s.events) == 0 && events.Frequent[ev.Kind] {
+			continue // 高频事件只发给显式订阅的渠道
+		}
+		msg := d.render(s, ev)
+		d.wg.Add(1)
+		go func(s sink) {
+			defer d.wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, d.timeout)
+			defer cancel()
+			if err := s.n.Notify(ctx, msg); err != nil {
+				d.log.Warn("通知发送失败", "sink", s.n.Name(), "event", ev.Kind, "err", err)
+				return
+			}
+			d.log.Debug("通知已发送", "sink", s.n.Name(), "event", ev.Kind)
+		}(s)
+	}
+}
+
+// Wait blocks until in-flight notifications finish or timeout elapses (used before exit).
+func (d *Dispatcher) Wait(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (d *Dispatcher) render(s sink, ev events.Event) Message {
+	msg := Message{Event: ev.Kind, Time: ev.Time, Fields: ev.Fields}
+	msg.Title = titleFor(ev.Kind)
+	if s.title != nil {
+		msg.Title = execute(s.title, msg)
+	}
+	body := s.body
+	if body == nil {
+		body = defaultBodies[ev.Kind]
+	}
+	if body != nil {
+		msg.Body = execute(body, msg)
+	}
+	if d.redact != nil {
+		msg.Title = d.redact(msg.Title)
+		msg.Body = d.redact(msg.Body)
+		fields := make(map[string]any, len(ev.Fields))
+		for k, v := range ev.Fields {
+			if str, ok := v.(string); ok {
+				v = d.redact(str)
+			}
+			fields[k] = v
+		}
+		msg.Fields = fields
+	}
+	return msg
+}
+
+func titleFor(kind string) string {
+	if t, ok := defaultTitles[kind]; ok {
+		return "[WZJ] " + t
+	}
+	return "[WZJ] " + kind
+}
+
+func execute(t *template.Template, msg Message) string {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, msg); err != nil {
+		return fmt.Sprintf("%s (template error: %v)", msg.Event, err)
+	}
+	// 缺失字段在 map 上渲染为 <no value>，统一去掉
+	return strings.TrimSpace(strings.ReplaceAll(buf.String(), "<no value>", ""))
+}
@@ -0,0 +1,222 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+)
+
+// sampleFields are typical fields of each event kind, as main and qrws publish them.
+var sampleFields = map[string]map[string]any{
+	events.SignDetected:   {"name": "软件工程", "courseId": 1234, "signId": 5678, "type": "qr"},
+	events.SignSucceeded:  {"name": "软件工程", "signId": 5678, "type": "gps"},
+	events.SignFailed:     {"name": "软件工程", "signId": 5678, "type": "gps", "errorCode": 305},
+	events.QRResult:       {"name": "测试同学", "rank": 7, "signId": 5678},
+	events.OpenIDExpired:  {"error": "HTTP 401"},
+	events.OpenIDRenewed:  nil,
+	events.WSConnected:    {"clientId": "abc"},
+	events.WSDisconnected: {"error": "read timeout"},
+	events.AutoQRFailed:   {"mode": "exec", "signId": 5678, "failures": 2, "retryable": true, "error": "exit status 1"},
+	events.QRRefreshed:    {"signId": 5678, "hash": "1a2b3c", "intervalMs": 5000, "anomaly": "duplicate"},
+	events.WSUnknown:      {"reason": "unknown_type", "channel": "/attendance/*/*/qr", "type": 9, "keys": []string{"type", "x"}},
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	want := map[string][2]string{
+		events.SignDetected:   {"[WZJ] 检测到签到", "软件工程 courseId=1234 signId=5678 类型=qr"},
+		events.SignSucceeded:  {"[WZJ] 签到成功", "软件工程 (gps) signId=5678"},
+		events.SignFailed:     {"[WZJ] 签到失败", "软件工程 (gps) signId=5678 错误: 305"},
+		events.QRResult:       {"[WZJ] 二维码签到结果", "测试同学 排名 7 signId=5678"},
+		events.OpenIDExpired:  {"[WZJ] openid 已失效", "openid 已失效，轮询已暂停，请尽快提供新的 openid。原因: HTTP 401"},
+		events.OpenIDRenewed:  {"[WZJ] openid 已更新", "已使用新的 openid 恢复轮询"},
+		events.WSConnected:    {"[WZJ] WS 已连接", "clientId=abc"},
+		events.WSDisconnected: {"[WZJ] WS 连接断开", "二维码通道连接中断，正在重连: read timeout"},
+		events.AutoQRFailed:   {"[WZJ] 自动扫码失败", "exec signId=5678 第 2 次失败（可重试: true）: exit status 1"},
+		events.QRRefreshed:    {"[WZJ] 二维码已刷新", "signId=5678 hash=1a2b3c 间隔 5000ms duplicate"},
+		events.WSUnknown:      {"[WZJ] 收到未识别的 WS 消息", "unknown_type channel=/attendance/*/*/qr type=9 keys=[type x]"},
+	}
+	d := &Dispatcher{}
+	for kind := range defaultTitles {
+		if _, ok := defaultBodies[kind]; !ok {
+			t.Errorf("%s has a title but no default body", kind)
+		}
+		if _, ok := want[kind]; !ok {
+			t.Errorf("%s has no expected rendering in this test", kind)
+		}
+	}
+	for kind, w := range want {
+		msg := d.render(sink{}, events.Event{Kind: kind, Time: time.Now(), Fields: sampleFields[kind]})
+		if msg.Title != w[0] || msg.Body != w[1] {
+			t.Errorf("%s:\n got  %q / %q\n want %q / %q", kind, msg.Title, msg.Body, w[0], w[1])
+		}
+	}
+}
+
+func TestRenderMissingFieldsAndCustomTemplates(t *testing.T) {
+	d := &Dispatcher{redact: func(s string) string { return strings.ReplaceAll(s, "测试同学", "[name]") }}
+
+	// 缺失字段渲染为空，而不是 <no value>
+	msg := d.render(sink{}, events.Event{Kind: events.SignFailed, Fields: map[string]any{"error": "timeout"}})
+	if strings.Contains(msg.Body, "no value") || msg.Body != "() signId= 错误: timeout" {
+		t.Fatalf("body = %q", msg.Body)
+	}
+
+	// 未知事件只有默认标题
+	msg = d.render(sink{}, events.Event{Kind: "something_new"})
+	if msg.Title != "[WZJ] something_new" || msg.Body != "" {
+		t.Fatalf("unknown kind = %+v", msg)
+	}
+
+	s := sink{
+		title: mustTemplate(t, "{{.Event}}: {{.Fields.name}}"),
+		body:  mustTemplate(t, "rank={{.Fields.rank}} at {{.Time.Format \"15:04\"}}"),
+	}
+	at := time.Date(2026, 10, 1, 8, 30, 0, 0, time.Local)
+	msg = d.render(s, events.Event{Kind: events.QRResult, Time: at, Fields: map[string]any{"name": "测试同学", "rank": 3}})
+	if msg.Title != "qr_result: [name]" || msg.Body != "rank=3 at 08:30" {
+		t.Fatalf("custom = %q / %q", msg.Title, msg.Body)
+	}
+	if msg.Fields["name"] != "[name]" || msg.Fields["rank"] != 3 {
+		t.Fatalf("fields not redacted: %v", msg.Fields)
+	}
+}
+
+func mustTemplate(t *testing.T, text string) *template.Template {
+	t.Helper()
+	tpl, err := parseTemplate("test", text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tpl
+}
+
+// webhookStub collects the messages POSTed to it; it fails while fail is set.
+type webhookStub struct {
+	mu   sync.Mutex
+	msgs []Message
+	fail bool
+	srv  *httptest.Server
+}
+
+func newWebhookStub(t *testing.T) *webhookStub {
+	w := &webhookStub{}
+	w.srv = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var m Message
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.fail {
+			http.Error(rw, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.msgs = append(w.msgs, m)
+	}))
+	t.Cleanup(w.srv.Close)
+	return w
+}
+
+func (w *webhookStub) kinds() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var out []string
+	for _, m := range w.msgs {
+		out = append(out, m.Event)
+	}
+	return out
+}
+
+func TestDispatchEventFilter(t *testing.T) {
+	explicit, all := newWebhookStub(t), newWebhookStub(t)
+	d, err := NewDispatcher([]SinkOptions{
+		{Type: "webhook", URL: explicit.srv.URL, Events: []string{events.QRResult, events.QRRefreshed}},
+		{Type: "webhook", URL: all.srv.URL},
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{events.SignDetected, events.QRRefreshed, events.QRResult} {
+		d.Dispatch(context.Background(), events.Event{Kind: kind, Fields: sampleFields[kind]})
+		d.Wait(5 * time.Second) // 逐个等待，保证顺序
+	}
+	if got := strings.Join(explicit.kinds(), ","); got != "qr_refreshed,qr_result" {
+		t.Fatalf("explicit sink got %s", got)
+	}
+	// 空 events 表示全部，但高频的 qr_refreshed 只发给显式订阅的渠道
+	if got := strings.Join(all.kinds(), ","); got != "sign_detected,qr_result" {
+		t.Fatalf("catch-all sink got %s", got)
+	}
+}
+
+func TestSinkErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts SinkOptions
+	}{
+		{"unknown type", SinkOptions{Type: "pager"}},
+		{"webhook without url", SinkOptions{Type: "webhook"}},
+		{"smtp without recipients", SinkOptions{Type: "smtp", SMTPAddr: "mail:25", From: "a@b"}},
+		{"smtp bad addr", SinkOptions{Type: "smtp", SMTPAddr: "mail", From: "a@b", To: []string{"c@d"}}},
+		{"command without argv", SinkOptions{Type: "command"}},
+		{"bad title template", SinkOptions{Type: "webhook", URL: "http://x", Title: "{{.Event"}},
+		{"bad body template", SinkOptions{Type: "webhook", URL: "http://x", Template: "{{if}}"}},
+	} {
+		if _, err := NewDispatcher([]SinkOptions{tt.opts}, nil, nil); err == nil {
+			t.Errorf("%s: want error", tt.name)
+		}
+	}
+
+	stub := newWebhookStub(t)
+	stub.fail = true
+	wh, err := NewWebhook(SinkOptions{URL: stub.srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wh.Notify(context.Background(), Message{Event: "x"}); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("webhook err = %v, want HTTP 500", err)
+	}
+}
+
+func TestCommandSink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	ok, err := NewCommand(SinkOptions{Command: []string{"sh", "-c", `test "$1" = "$WZJ_EVENT" && test -n "$WZJ_FIELDS"`, "sh", "{{.Event}}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ok.Notify(context.Background(), Message{Event: "qr_result", Fields: map[string]any{"rank": 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	fail, _ := NewCommand(SinkOptions{Command: []string{"sh", "-c", "echo oops; exit 3"}})
+	if err := fail.Notify(context.Background(), Message{}); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Fatalf("err = %v, want the command output", err)
+	}
+
+	// 后台子进程占着输出管道时，超时后不会一直等下去
+	hung, _ := NewCommand(SinkOptions{Command: []string{"sh", "-c", "sleep 30 & sleep 30"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := hung.Notify(ctx, Message{}); err == nil {
+		t.Fatal("want an error from a killed command")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Notify returned after %v", d)
+	}
+}
@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Webhook POSTs the message as JSON.
+type Webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewWebhook(c SinkOptions) (*Webhook, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("webhook: url is required")
+	}
+	return &Webhook{url: c.URL, headers: c.Headers, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (w *Webhook) Name() string { return "webhook" }
+
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook: HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+	return nil
+}
+
+// SMTP sends a plain-text email (STARTTLS when the server offers it, via net/smtp).
+type SMTP struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func NewSMTP(c SinkOptions) (*SMTP, error) {
+	if c.SMTPAddr == "" || c.From == "" || len(c.To) == 0 {
+		return nil, fmt.Errorf("smtp: smtp_addr, from and to are required")
+	}
+	if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+		return nil, fmt.Errorf("smtp: smtp_addr: %w", err)
+	}
+	return &SMTP{addr: c.SMTPAddr, username: c.Username, password: c.Password, from: c.From, to: c.To}, nil
+}
+
+func (s *SMTP) Name() string { return "smtp" }
+
+func (s *SMTP) Notify(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, _ := net.SplitHostPort(s.addr)
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&b, "Subject: =?UTF-8?B?%s?=\r\n", base64Std(msg.Title))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	b.WriteString("\r\n")
+	// net/smtp 不支持 context，放到协程里以便按 ctx 超时返回
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(s.addr, auth, s.from, s.to, []byte(b.String())) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Command runs a local program; each argument is a template over the Message and the
+// message is also exposed as WZJ_EVENT / WZJ_TITLE / WZJ_BODY / WZJ_FIELDS (JSON).
+type Command struct {
+	args []*template.Template
+}
+
+func NewCommand(c SinkOptions) (*Command, error) {
+	if len(c.Command) == 0 {
+		return nil, fmt.Errorf("command: command is required")
+	}
+	cmd := &Command{}
+	for i, a := range c.Command {
+		t, err := parseTemplate(fmt.Sprintf("arg%d", i), a)
+		if err != nil {
+			return nil, fmt.Errorf("command: arg %d: %w", i, err)
+		}
+		cmd.args = append(cmd.args, t)
+	}
+	return cmd, nil
+}
+
+func (c *Command) Name() string { return "command" }
+
+func (c *Command) Notify(ctx context.Context, msg Message) error {
+	args := make([]string, len(c.args))
+	for i, t := range c.args {
+		args[i] = execute(t, msg)
+	}
+	fields, _ := json.Marshal(msg.Fields)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"WZJ_EVENT="+msg.Event,
+		"WZJ_TITLE="+msg.Title,
+		"WZJ_BODY="+msg.Body,
+		"WZJ_FIELDS="+string(fields),
+	)
+	// 通知命令派生的子进程可能一直占着输出管道，超时后最多再等 1 秒，不拖住事件分发
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("command: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func base64Std(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
@@ -1,19 +1,211 @@
 package qr
 
 import (
-    qrterminal "github.com/mdp/qrterminal/v3"
-    "os"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	qrcode "github.com/skip2/go-qrcode"
+	"golang.org/x/term"
+)
+
+// Rendering modes.
+const (
+	ModeFull  = "full"  // 每个模块两列 ANSI 背景色块，任意终端主题都清晰，但最大
+	ModeHalf  = "half"  // 半块字符 ▀▄█，一行显示两行模块，面积约为 full 的 1/4
+	ModeASCII = "ascii" // 只用 ASCII（##），适合不支持 Unicode/ANSI 的终端
+)
+
+const (
+	ansiWhite = "\033[47m  \033[0m"
+	ansiBlack = "\033[40m  \033[0m"
+)
+
+// Options controls terminal rendering.
+type Options struct {
+	Writer    io.Writer // 默认 os.Stdout
+	Level     string    // 纠错级别 L/M/Q/H，默认 M
+	Mode      string    // full / half / ascii，默认 full
+	Invert    bool      // 反色（浅色终端主题下 half/ascii 需要）
+	QuietZone int       // 四周空白的模块数；0 取默认 1，负数表示不留白
+	Width     int       // 可用列数；0 时自动探测终端宽度，探测不到则不回退
+}
+
+var (
+	mu  sync.RWMutex
+	def = &Renderer{Terminal: &Options{}}
 )
 
-// Print renders the given URL as a QR code in terminal (stdout).
+// SetDefault sets the renderer used by Print (terminal only until called).
+func SetDefault(r *Renderer) {
+	mu.Lock()
+	def = r
+	mu.Unlock()
+}
+
+// Print sends the given URL to every target of the default renderer.
 func Print(url string) {
-    // Use a medium level and a reasonable size for typical terminals
-    cfg := qrterminal.Config{
-        Level:     qrterminal.M,
-        Writer:    os.Stdout,
-        BlackChar: qrterminal.BLACK, // full block
-        WhiteChar: qrterminal.WHITE,
-        QuietZone: 1,
-    }
-    qrterminal.GenerateWithConfig(url, cfg)
+	mu.RLock()
+	r := def
+	mu.RUnlock()
+	if err := r.Render(url); err != nil {
+		fmt.Fprintln(os.Stderr, "二维码输出失败:", err, url)
+	}
+}
+
+// CheckOptions validates the configurable fields.
+func CheckOptions(o Options) error {
+	if _, err := level(o.Level); err != nil {
+		return err
+	}
+	switch o.Mode {
+	case "", ModeFull, ModeHalf, ModeASCII:
+		return nil
+	}
+	return fmt.Errorf("qr mode must be full, half or ascii, got %q", o.Mode)
+}
+
+// Render writes url as a QR code. When the terminal is narrower than the code, it falls
+// back to half blocks (full only), then to level L, and finally prints the URL instead.
+func Render(url string, o Options) error {
+	lvl, err := level(o.Level)
+	if err != nil {
+		return err
+	}
+	mode := o.Mode
+	if mode == "" {
+		mode = ModeFull
+	}
+	quiet := o.QuietZone
+	if quiet == 0 {
+		quiet = 1
+	} else if quiet < 0 {
+		quiet = 0
+	}
+	w := writer(o)
+	width := o.Width
+	if width == 0 {
+		width = termWidth(w)
+	}
+	bm, err := bitmap(url, lvl)
+	if err != nil {
+		return err
+	}
+	if width > 0 && columns(mode, len(bm)+2*quiet) > width {
+		if mode == ModeFull {
+			mode = ModeHalf
+		}
+		if columns(mode, len(bm)+2*quiet) > width && lvl != qrcode.Low {
+			if bm, err = bitmap(url, qrcode.Low); err != nil {
+				return err
+			}
+		}
+		if columns(mode, len(bm)+2*quiet) > width {
+			_, err := fmt.Fprintf(w, "终端宽度 %d 列不足以显示二维码（需要 %d 列），请放大窗口或使用链接: %s\n", width, columns(mode, len(bm)+2*quiet), url)
+			return err
+		}
+	}
+	_, err = io.WriteString(w, draw(bm, mode, quiet, o.Invert))
+	return err
+}
+
+func writer(o Options) io.Writer {
+	if o.Writer != nil {
+		return o.Writer
+	}
+	return os.Stdout
+}
+
+func level(s string) (qrcode.RecoveryLevel, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return qrcode.Low, nil
+	case "", "M":
+		return qrcode.Medium, nil
+	case "Q":
+		return qrcode.High, nil
+	case "H":
+		return qrcode.Highest, nil
+	}
+	return 0, fmt.Errorf("qr level must be L, M, Q or H, got %q", s)
+}
+
+// bitmap returns the modules without border; true is a dark module.
+func bitmap(url string, lvl qrcode.RecoveryLevel) ([][]bool, error) {
+	code, err := qrcode.New(url, lvl)
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	return code.Bitmap(), nil
+}
+
+// columns is the rendered width of n modules (code plus quiet zone).
+func columns(mode string, n int) int {
+	if mode == ModeHalf {
+		return n
+	}
+	return 2 * n
+}
+
+// termWidth returns the width of w when it is a terminal, else $COLUMNS, else 0.
+func termWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if cols, _, err := term.GetSize(int(f.Fd())); err == nil {
+			return cols
+		}
+	}
+	n, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	return n
+}
+
+// draw renders the bitmap. half and ascii draw light modules with the foreground
+// colour, which suits dark themes; invert swaps that (and the colours in full mode).
+func draw(bm [][]bool, mode string, quiet int, invert bool) string {
+	n := len(bm) + 2*quiet
+	// dark reports whether module (x, y) of the padded code is dark; outside is light.
+	dark := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		d := y >= 0 && y < len(bm) && x >= 0 && x < len(bm) && bm[y][x]
+		return d != invert
+	}
+	var b strings.Builder
+	switch mode {
+	case ModeHalf:
+		for y := 0; y < n; y += 2 {
+			for x := 0; x < n; x++ {
+				top, bottom := !dark(x, y), y+1 < n && !dark(x, y+1)
+				switch {
+				case top && bottom:
+					b.WriteString("█")
+				case top:
+					b.WriteString("▀")
+				case bottom:
+					b.WriteString("▄")
+				default:
+					b.WriteString(" ")
+				}
+			}
+			b.WriteString("\n")
+		}
+	default:
+		light, black := "##", "  "
+		if mode == ModeFull {
+			light, black = ansiWhite, ansiBlack
+		}
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				if dark(x, y) {
+					b.WriteString(black)
+				} else {
+					b.WriteString(light)
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
 }
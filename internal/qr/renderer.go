@@ -0,0 +1,161 @@
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// TargetTerminal is the qr_outputs entry for terminal rendering; every other entry is a
+// file path whose extension (.png or .svg) picks the format.
+const TargetTerminal = "terminal"
+
+// 文件输出使用标准的 4 模块留白
+const fileQuietZone = 4
+
+// Renderer writes every refreshed QR URL to all of its targets.
+type Renderer struct {
+	Terminal *Options // nil 表示不在终端显示
+	Files    []string // .png / .svg 文件，每次刷新原子替换（如 latest.png）
+	PNGSize  int      // PNG 边长（像素），默认 320
+	Level    string   // 文件输出的纠错级别，默认 M
+}
+
+// NewRenderer builds a renderer from qr_outputs entries; term is used for "terminal".
+func NewRenderer(outputs []string, term Options, pngSize int, level string) (*Renderer, error) {
+	r := &Renderer{PNGSize: pngSize, Level: level}
+	for _, out := range outputs {
+		if out == TargetTerminal {
+			t := term
+			r.Terminal = &t
+			continue
+		}
+		if err := CheckOutput(out); err != nil {
+			return nil, err
+		}
+		r.Files = append(r.Files, out)
+	}
+	return r, nil
+}
+
+// CheckOutput validates one qr_outputs entry.
+func CheckOutput(out string) error {
+	if out == TargetTerminal {
+		return nil
+	}
+	switch strings.ToLower(filepath.Ext(out)) {
+	case ".png", ".svg":
+		return nil
+	}
+	return fmt.Errorf("qr output %q: want %q or a .png/.svg file", out, TargetTerminal)
+}
+
+// Render sends url to every target; one failing target does not stop the others.
+func (r *Renderer) Render(url string) error {
+	var errs []error
+	if r.Terminal != nil {
+		if err := Render(url, *r.Terminal); err != nil {
+			errs = append(errs, fmt.Errorf("terminal: %w", err))
+		}
+	}
+	for _, path := range r.Files {
+		var data []byte
+		var err error
+		if strings.EqualFold(filepath.Ext(path), ".svg") {
+			data, err = SVG(url, r.Level)
+		} else {
+			data, err = PNG(url, r.Level, r.PNGSize)
+		}
+		if err == nil {
+			err = WriteFileAtomic(path, data)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PNG encodes url as a size×size PNG (default 320) with a 4-module border.
+func PNG(url, lvl string, size int) ([]byte, error) {
+	l, err := level(lvl)
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		size = 320
+	}
+	code, err := qrcode.New(url, l)
+	if err != nil {
+		return nil, err
+	}
+	return code.PNG(size)
+}
+
+// SVG encodes url as a scalable SVG, one unit per module, with a 4-module border.
+func SVG(url, lvl string) ([]byte, error) {
+	l, err := level(lvl)
+	if err != nil {
+		return nil, err
+	}
+	bm, err := bitmap(url, l)
+	if err != nil {
+		return nil, err
+	}
+	n := len(bm) + 2*fileQuietZone
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bm {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			run := 0
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", x+fileQuietZone, y+fileQuietZone, run, run)
+			x += run
+		}
+	}
+	b.WriteString(`"/></svg>` + "\n")
+	return []byte(b.String()), nil
+}
+
+// WriteFileAtomic replaces path with data via a temporary file in the same directory,
+// so readers (image viewers, scripts polling latest.png) never see a partial file.
+func WriteFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -1,76 +1,192 @@
 package qrws
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qr"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/metrics"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/redact"
 )
 
 // Minimal Bayeux/Faye client tailored for Teachermate QR channel
 
-// logging helpers with timestamp and debug gate
-var debugEnabled bool
-
-func SetDebug(b bool)                  { debugEnabled = b }
-func ts() string                       { return time.Now().Format("2006-01-02 15:04:05.000") }
-func infoln(args ...any)               { fmt.Println(append([]any{"[" + ts() + "]"}, args...)...) }
-func infof(format string, args ...any) { fmt.Printf("[%s] ", ts()); fmt.Printf(format, args...) }
-func dbgln(args ...any) {
-	if debugEnabled {
-		infoln(args...)
-	}
+// Options 控制 WS 连接的保活与超时行为
+type Options struct {
+	Endpoint string
+	// ReadTimeout 内未收到任何帧（含 pong）即判定连接失效并触发重连
+	ReadTimeout time.Duration
+	// WriteTimeout 单次写入（含 ping 控制帧）的超时
+	WriteTimeout time.Duration
+	// PingInterval 发送 WebSocket ping 的间隔，应明显小于 ReadTimeout
+	PingInterval time.Duration
+	// MaxMessageSize 单帧最大字节数，超过即断开
+	MaxMessageSize int64
+	// Recorder 非空时记录全部收发帧（JSONL），用于离线回放
+	Recorder *Recorder
+	// Logger 为空时丢弃日志
+	Logger *slog.Logger
+	// Events 非空时发布连接状态事件（ws_connected / ws_disconnected）
+	Events *events.Bus
+	// Discovery 记录无法识别的消息（JSONL）；为空时只在内存中计数
+	Discovery *Discovery
+	// ReconnectMin/ReconnectMax 断线重连的退避区间
+	ReconnectMin time.Duration
+	ReconnectMax time.Duration
+	// OwnResult 判断 type=3 结果是否属于本人；非空时只有本人结果进入 ResultCh，
+	// 其他同学的结果只记录日志，不会占满通道而挤掉本人结果
+	OwnResult func(StudentResult) bool
 }
-func dbgf(format string, args ...any) {
-	if debugEnabled {
-		infof(format, args...)
+
+// DefaultOptions returns the keepalive settings used by New.
+func DefaultOptions() Options {
+	return Options{
+		Endpoint:       "wss://www.teachermate.com.cn/faye",
+		ReadTimeout:    90 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		PingInterval:   30 * time.Second,
+		MaxMessageSize: 1 << 20,
+		ReconnectMin:   time.Second,
+		ReconnectMax:   30 * time.Second,
 	}
 }
 
 type Client struct {
 	endpoint   string
+	opts       Options
 	conn       *websocket.Conn
 	mu         sync.Mutex
 	clientID   string
 	connected  bool
-	seq        int
+	heartbeat  bool // 当前连接的心跳协程是否已启动
+	seq        atomic.Int64
 	subscribed string // courseId/signId key
-	stopCh     chan struct{}
+	// 服务端已确认(subscribe ack)的订阅频道，新连接/重新握手时清空
+	subscriptions []string
+	// 生命周期：running 表示 Start 后尚未 Close；stopCh 每次 Start 重新创建，wg 跟踪全部后台协程
+	running       bool
+	stopCh        chan struct{}
+	closed        chan struct{} // Close 进行中非空，全部协程退出后关闭；期间 Start 会等待
+	wg            sync.WaitGroup
+	disconnectAck chan struct{}
+	recorder      *Recorder
+	log           *slog.Logger
+	events        *events.Bus
+	replaying     bool // 回放模式：不启动心跳、不按 advice 休眠
+	timeline      *qrTimeline
+	discovery     *Discovery
 	// 学生结果通道：当服务端推送 type=3 时，向外部报告一次
 	ResultCh chan StudentResult
-	// 二维码链接通道：当服务端推送 type=1 时，向外部发送最新 qrUrl
+	// 二维码链接通道：当服务端推送 type=1 时，向外部发送最新 qrUrl（只保留最新一个，不阻塞读循环）。
+	// 客户端本身不做任何渲染，由调用方消费后显示/扫描
 	QrURLCh       chan string
 	handshakeDone chan struct{}
 }
 
 func New() *Client {
+	return NewWithOptions(DefaultOptions())
+}
+
+// NewWithOptions creates a client; zero-valued fields fall back to DefaultOptions.
+func NewWithOptions(opts Options) *Client {
+	def := DefaultOptions()
+	if opts.Endpoint == "" {
+		opts.Endpoint = def.Endpoint
+	}
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = def.ReadTimeout
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = def.WriteTimeout
+	}
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = def.PingInterval
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = def.MaxMessageSize
+	}
+	if opts.ReconnectMin <= 0 {
+		opts.ReconnectMin = def.ReconnectMin
+	}
+	if opts.ReconnectMax < opts.ReconnectMin {
+		opts.ReconnectMax = def.ReconnectMax
+		if opts.ReconnectMax < opts.ReconnectMin {
+			opts.ReconnectMax = opts.ReconnectMin
+		}
+	}
+	if opts.Logger == nil {
+		opts.Logger = logging.Discard()
+	}
+	if opts.Discovery == nil {
+		opts.Discovery, _ = NewDiscovery("")
+	}
 	return &Client{
-		endpoint: "wss://www.teachermate.com.cn/faye",
-		stopCh:   make(chan struct{}),
-		ResultCh: make(chan StudentResult, 1),
-		QrURLCh:  make(chan string, 1),
+		endpoint:  opts.Endpoint,
+		opts:      opts,
+		recorder:  opts.Recorder,
+		log:       opts.Logger,
+		events:    opts.Events,
+		timeline:  newQRTimeline(),
+		discovery: opts.Discovery,
+		ResultCh:  make(chan StudentResult, 1),
+		QrURLCh:   make(chan string, 1),
 	}
 }
 
 func (c *Client) nextSeq() string {
-	c.seq++
-	return fmt.Sprintf("%d", c.seq)
+	return fmt.Sprintf("%d", c.seq.Add(1))
 }
 
 // Start establishes the connection and performs handshake + connect, keeping heartbeats.
 // It does not subscribe to any course/sign yet (preconnect).
+// 连接建立后若中断（读错误/读超时），会按退避策略自动重连并恢复订阅。
+// Close 之后可再次调用 Start 重新建立连接，已登记的订阅目标会在 connect 后恢复。
 func (c *Client) Start() error {
 	c.mu.Lock()
-	if c.conn != nil {
+	// 上一次 Close 尚未结束（等待 disconnect 应答或协程退出）时先等它完成，
+	// 否则新的 stopCh 与协程会被旧的 Close 关掉或漏掉
+	for c.closed != nil {
+		closed := c.closed
+		c.mu.Unlock()
+		<-closed
+		c.mu.Lock()
+	}
+	if c.running {
 		c.mu.Unlock()
 		return nil
 	}
+	c.running = true
+	stop := make(chan struct{})
+	c.stopCh = stop
+	c.mu.Unlock()
+	conn, err := c.dial()
+	if err != nil {
+		c.mu.Lock()
+		c.running = false
+		c.mu.Unlock()
+		return err
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run(conn, stop)
+	}()
+	return nil
+}
+
+func (c *Client) dial() (*websocket.Conn, error) {
 	u, _ := url.Parse(c.endpoint)
 	// 添加超时控制
 	dialer := &websocket.Dialer{HandshakeTimeout: 10 * time.Second, Subprotocols: []string{"bayeux"}}
@@ -78,192 +194,390 @@ func (c *Client) Start() error {
 	hdr := http.Header{"Origin": []string{"https://www.teachermate.com.cn"}}
 	conn, _, err := dialer.Dial(u.String(), hdr)
 	if err != nil {
+		return nil, err
+	}
+	// 限制单帧大小；读超时在每次读取前与收到 pong 时顺延
+	conn.SetReadLimit(c.opts.MaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(c.opts.ReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		c.log.Debug("pong")
+		return conn.SetReadDeadline(time.Now().Add(c.opts.ReadTimeout))
+	})
+	return conn, nil
+}
+
+// run serves one connection at a time and reconnects with backoff until Close.
+func (c *Client) run(conn *websocket.Conn, stop <-chan struct{}) {
+	for {
+		err := c.serve(conn, stop)
+		if stopped(stop) {
+			return
+		}
+		c.log.Warn("连接中断，准备重连", "err", err)
+		metrics.WSConnected.Set(0)
+		c.events.Publish(events.WSDisconnected, map[string]any{"error": errString(err)})
+		conn = c.redial(stop)
+		if conn == nil {
+			return
+		}
+		c.log.Info("重连成功，重新握手")
+	}
+}
+
+// serve performs handshake on conn and blocks in the read loop until it fails.
+func (c *Client) serve(conn *websocket.Conn, stop <-chan struct{}) error {
+	done := make(chan struct{})
+	c.mu.Lock()
+	// Close 可能发生在拨号/重连期间：此时不再接管新连接，否则 Close 要等到读超时才能返回
+	if stopped(stop) {
 		c.mu.Unlock()
-		return err
+		_ = conn.Close()
+		return nil
 	}
 	c.conn = conn
-	c.mu.Unlock()
-
-	// reader loop
-	go c.readLoop()
-	// send handshake（注意：此处不能持锁，否则 send 内部加锁会导致死锁）
+	c.clientID = ""
+	c.connected = false
+	c.heartbeat = false
+	c.subscriptions = nil
 	// 重置握手完成信号
-	c.mu.Lock()
 	c.handshakeDone = make(chan struct{})
+	handshakeDone := c.handshakeDone
 	c.mu.Unlock()
-	c.send([]any{map[string]any{
-		"channel":        "/meta/handshake",
-		"version":        "1.0",
-		"minimumVersion": "1.0",
-		"supportedConnectionTypes": []string{
-			"websocket", "eventsource", "long-polling", "cross-origin-long-polling", "callback-polling",
-		},
-		"id": c.nextSeq(),
-	}})
-	infoln("[WS] handshake sent")
+	defer func() {
+		close(done)
+		c.mu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.connected = false
+		c.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		c.pingLoop(conn, done)
+	}()
+	// send handshake（注意：此处不能持锁，否则 send 内部加锁会导致死锁）
+	c.sendHandshake()
+	c.log.Info("handshake sent")
 	// 握手 5 秒超时提示（不阻塞流程）
 	go func(ch <-chan struct{}) {
+		defer c.wg.Done()
 		select {
 		case <-ch:
-			dbgln("[WS] handshake success signal received")
+			c.log.Debug("handshake success signal received")
 		case <-time.After(5 * time.Second):
-			infoln("[WS] handshake timeout: no response within 5s")
-		case <-c.stopCh:
+			c.log.Warn("handshake timeout: no response within 5s")
+		case <-done:
 		}
-	}(c.handshakeDone)
-	return nil
+	}(handshakeDone)
+	return c.readLoop(conn, done, stop)
 }
 
-func (c *Client) Close() {
+// redial retries dialing with exponential backoff; returns nil once stopped.
+func (c *Client) redial(stop <-chan struct{}) *websocket.Conn {
+	wait := c.opts.ReconnectMin
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(wait):
+		}
+		conn, err := c.dial()
+		if err == nil {
+			metrics.WSReconnects.Inc()
+			return conn
+		}
+		c.log.Warn("重连失败", "err", err, "retry_in", wait*2)
+		wait *= 2
+		if wait > c.opts.ReconnectMax {
+			wait = c.opts.ReconnectMax
+		}
+	}
+}
 
+func stopped(stop <-chan struct{}) bool {
 	select {
-	case <-c.stopCh:
-		// already closed
+	case <-stop:
+		return true
 	default:
-		close(c.stopCh)
-	}
-	if c.conn != nil {
-		_ = c.conn.Close()
-		c.conn = nil
+		return false
 	}
 }
 
-func (c *Client) readLoop() {
-	dbgln("[WS] readLoop started")
-	defer dbgln("[WS] readLoop exit")
+// pingLoop sends WebSocket ping control frames so half-open connections surface as read timeouts.
+func (c *Client) pingLoop(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(c.opts.PingInterval)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-c.stopCh:
+		case <-done:
 			return
-		default:
+		case <-ticker.C:
+			// WriteControl 可与其他写操作并发调用
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.opts.WriteTimeout)); err != nil {
+				c.log.Debug("ping failed", "err", err)
+				return
+			}
+			c.log.Debug("ping")
 		}
-		_, data, err := c.conn.ReadMessage()
-		if err != nil {
-			infoln("[WS] read error:", err)
-			return
+	}
+}
+
+// Close politely ends the session: it sends /meta/disconnect (waiting briefly for the ack),
+// closes the socket and waits for all background goroutines to exit or ctx to expire.
+// 关闭后可再次调用 Start。
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return nil
+	}
+	c.running = false
+	stop := c.stopCh
+	closed := make(chan struct{})
+	c.closed = closed
+	polite := c.connected && c.clientID != ""
+	clientID := c.clientID
+	ack := make(chan struct{})
+	c.disconnectAck = ack
+	c.mu.Unlock()
+
+	if polite {
+		c.send([]any{map[string]any{
+			"channel":  "/meta/disconnect",
+			"clientId": clientID,
+			"id":       c.nextSeq(),
+		}})
+		c.log.Debug("disconnect sent")
+		// 最多等待 2 秒的 disconnect 应答，不影响后续关闭
+		select {
+		case <-ack:
+			c.log.Info("disconnect ok")
+		case <-time.After(2 * time.Second):
+			c.log.Debug("disconnect ack timeout")
+		case <-ctx.Done():
 		}
-		if len(data) > 0 {
-			raw := data
-			if len(raw) > 1024 {
-				raw = raw[:1024]
+	}
+
+	c.mu.Lock()
+	close(stop)
+	conn := c.conn
+	c.conn = nil
+	c.clientID = ""
+	c.connected = false
+	c.subscriptions = nil
+	c.disconnectAck = nil
+	c.mu.Unlock()
+	metrics.WSConnected.Set(0)
+	if conn != nil {
+		_ = conn.Close()
+	}
+
+	// 等待读循环/心跳/ping 等协程全部退出；ctx 先到期时仍在后台等待，之后才允许 Start
+	go func() {
+		c.wg.Wait()
+		c.mu.Lock()
+		c.closed = nil
+		c.mu.Unlock()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("qrws close: %w", ctx.Err())
+	}
+}
+
+func (c *Client) readLoop(conn *websocket.Conn, done, stop <-chan struct{}) error {
+	c.log.Debug("readLoop started")
+	defer c.log.Debug("readLoop exit")
+	for {
+		// 每次读取前顺延读超时：超时即视为连接失效（半开连接）
+		_ = conn.SetReadDeadline(time.Now().Add(c.opts.ReadTimeout))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if stopped(stop) {
+				// Close 主动关闭连接导致的读错误，无需提示
+				return nil
 			}
-			dbgf("[WS][RAW %dB] %s\n", len(data), string(raw))
-		}
-		// parse array of messages
-		var msgs []map[string]any
-		if err := json.Unmarshal(data, &msgs); err != nil {
-			dbgln("[WS] invalid JSON frame")
-			continue
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				c.log.Warn("读超时，判定连接失效", "read_timeout", c.opts.ReadTimeout)
+			} else {
+				c.log.Warn("read error", "err", err)
+			}
+			return err
 		}
-		if len(msgs) == 0 {
-			// heartbeat reply
-			dbgln("[WS] heartbeat ack []")
-			continue
+		c.recordFrame(dirIn, data)
+		c.handleFrame(data, done)
+	}
+}
+
+// handleFrame parses one inbound Bayeux frame and dispatches its messages.
+// 读循环与离线回放（Replay）共用此入口。
+func (c *Client) handleFrame(data []byte, done <-chan struct{}) {
+	if len(data) > 0 {
+		raw := data
+		if len(raw) > 1024 {
+			raw = raw[:1024]
 		}
-		dbgln("[WS] messages count:", len(msgs))
-		for i, m := range msgs {
-			ch, _ := m["channel"].(string)
-			succ, _ := m["successful"].(bool)
-			dbgf("[WS] msg[%d] channel=%s successful=%v\n", i, ch, succ)
-			if succ {
-				switch ch {
-				case "/meta/handshake":
-					if cid, ok := m["clientId"].(string); ok {
-						c.clientID = cid
-						// 发出握手完成信号
-						c.mu.Lock()
-						if c.handshakeDone != nil {
-							select {
-							case <-c.handshakeDone:
-							default:
-								close(c.handshakeDone)
-							}
+		c.log.Debug("RAW", "bytes", len(data), "frame", string(raw))
+	}
+	// parse array of messages
+	var msgs []map[string]any
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		c.log.Debug("invalid JSON frame")
+		return
+	}
+	if len(msgs) == 0 {
+		// heartbeat reply
+		c.log.Debug("heartbeat ack []")
+		return
+	}
+	c.log.Debug("messages", "count", len(msgs))
+	for i, m := range msgs {
+		ch, _ := m["channel"].(string)
+		succ, _ := m["successful"].(bool)
+		c.log.Debug("msg", "index", i, "channel", ch, "successful", succ)
+		if succ {
+			switch ch {
+			case "/meta/handshake":
+				if cid, ok := m["clientId"].(string); ok {
+					// 发出握手完成信号
+					c.mu.Lock()
+					c.clientID = cid
+					if c.handshakeDone != nil {
+						select {
+						case <-c.handshakeDone:
+						default:
+							close(c.handshakeDone)
 						}
-						c.mu.Unlock()
-						infoln("[WS] handshake ok, clientId=", c.clientID)
-						// connect once handshake succeeds
-						c.connect()
 					}
-				case "/meta/connect":
-					// advice.timeout present (ms)
-					timeout := 60000
-					if advice, ok := m["advice"].(map[string]any); ok {
-						if t, ok := advice["timeout"].(float64); ok {
-							timeout = int(t)
-						}
+					c.mu.Unlock()
+					c.log.Info("handshake ok", "clientId", cid)
+					// connect once handshake succeeds
+					c.connect()
+				}
+			case "/meta/connect":
+				// advice.timeout present (ms)
+				timeout := 60000
+				if advice, ok := m["advice"].(map[string]any); ok {
+					if t, ok := advice["timeout"].(float64); ok {
+						timeout = int(t)
 					}
-					startHeartbeat := !c.connected
-					c.connected = true
-					infoln("[WS] connect ok, timeout=", timeout)
-					if startHeartbeat {
-						go c.heartbeatLoop(timeout)
+				}
+				c.mu.Lock()
+				startHeartbeat := !c.heartbeat
+				c.connected = true
+				c.heartbeat = true
+				subscribed, clientID := c.subscribed, c.clientID
+				c.mu.Unlock()
+				c.log.Info("connect ok", "timeout", timeout)
+				if startHeartbeat {
+					metrics.WSConnected.Set(1)
+					c.events.Publish(events.WSConnected, map[string]any{"clientId": clientID})
+				}
+				if startHeartbeat && !c.replaying {
+					c.wg.Add(1)
+					go func() {
+						defer c.wg.Done()
+						c.heartbeatLoop(timeout, done)
+					}()
+				}
+				// 若之前已登记订阅目标，则在 connect 成功后自动订阅
+				if subscribed != "" && clientID != "" {
+					var courseID, signID int
+					fmt.Sscanf(subscribed, "%d/%d", &courseID, &signID)
+					if courseID > 0 && signID > 0 {
+						c.send([]any{map[string]any{
+							"channel":      "/meta/subscribe",
+							"clientId":     clientID,
+							"subscription": fmt.Sprintf("/attendance/%d/%d/qr", courseID, signID),
+							"id":           c.nextSeq(),
+						}})
+						c.log.Info("auto-subscribe after connect", "subscription", fmt.Sprintf("/attendance/%d/%d/qr", courseID, signID))
 					}
-					// 若之前已登记订阅目标，则在 connect 成功后自动订阅
-					if c.subscribed != "" && c.clientID != "" {
-						var courseID, signID int
-						fmt.Sscanf(c.subscribed, "%d/%d", &courseID, &signID)
-						if courseID > 0 && signID > 0 {
-							c.send([]any{map[string]any{
-								"channel":      "/meta/subscribe",
-								"clientId":     c.clientID,
-								"subscription": fmt.Sprintf("/attendance/%d/%d/qr", courseID, signID),
-								"id":           c.nextSeq(),
-							}})
-							infof("[WS] auto-subscribe after connect: /attendance/%d/%d/qr\n", courseID, signID)
-						}
+				}
+			case "/meta/subscribe":
+				c.log.Info("subscribe ack")
+				if ok, _ := m["successful"].(bool); ok {
+					if sub := strOf(m["subscription"]); sub != "" {
+						c.mu.Lock()
+						c.subscriptions = append(c.subscriptions, sub)
+						c.mu.Unlock()
 					}
-				case "/meta/subscribe":
-					infoln("[WS] subscribe ack")
 				}
-			} else {
-				// non-successful: 打印并按 advice 处理
-				if ch == "/meta/connect" {
-					// 可能包含 advice: { reconnect: "handshake", interval: ms }
-					if advice, ok := m["advice"].(map[string]any); ok {
-						if rc, ok := advice["reconnect"].(string); ok && rc == "handshake" {
-							interval := 0
-							if iv, ok := advice["interval"].(float64); ok {
-								interval = int(iv)
-							}
-							if interval > 0 {
-								dbgln("[WS] reconnect advice interval=", interval, "ms")
-								time.Sleep(time.Duration(interval) * time.Millisecond)
-							}
-							infoln("[WS] /meta/connect unknown client, re-handshaking...")
-							c.rehandshake()
-							continue
+			case "/meta/disconnect":
+				c.mu.Lock()
+				if c.disconnectAck != nil {
+					close(c.disconnectAck)
+					c.disconnectAck = nil
+				}
+				c.mu.Unlock()
+			default:
+				if !strings.HasPrefix(ch, "/meta/") && !isQRChannel(ch) {
+					c.unknown(UnknownChannel, ch, m)
+				}
+			}
+		} else {
+			// non-successful: 打印并按 advice 处理
+			if ch == "/meta/connect" {
+				// 可能包含 advice: { reconnect: "handshake", interval: ms }
+				if advice, ok := m["advice"].(map[string]any); ok {
+					if rc, ok := advice["reconnect"].(string); ok && rc == "handshake" {
+						interval := 0
+						if iv, ok := advice["interval"].(float64); ok {
+							interval = int(iv)
 						}
-					}
-					if errStr, ok := m["error"].(string); ok {
-						infoln("[WS] /meta/connect error:", errStr)
+						if interval > 0 && !c.replaying {
+							c.log.Debug("reconnect advice", "interval_ms", interval)
+							time.Sleep(time.Duration(interval) * time.Millisecond)
+						}
+						c.log.Warn("/meta/connect unknown client, re-handshaking...")
+						c.rehandshake()
+						continue
 					}
 				}
-				if isQRChannel(ch) {
-					dbgln("[WS] QR channel payload")
-					c.handleQRMessage(m)
+				if errStr, ok := m["error"].(string); ok {
+					c.log.Warn("/meta/connect error", "error", errStr)
 				}
 			}
+			if isQRChannel(ch) {
+				c.log.Debug("QR channel payload")
+				c.handleQRMessage(m)
+			} else if !strings.HasPrefix(ch, "/meta/") {
+				c.unknown(UnknownChannel, ch, m)
+			}
 		}
 	}
 }
 
 func (c *Client) connect() {
+	c.mu.Lock()
+	clientID := c.clientID
+	c.mu.Unlock()
 	c.send([]any{map[string]any{
 		"channel":        "/meta/connect",
-		"clientId":       c.clientID,
+		"clientId":       clientID,
 		"connectionType": "websocket",
 		"id":             c.nextSeq(),
 	}})
 }
 
-func (c *Client) heartbeatLoop(timeout int) {
+func (c *Client) heartbeatLoop(timeout int, done <-chan struct{}) {
 	// Half of server advice timeout
 	interval := time.Duration(timeout/2) * time.Millisecond
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	for {
 		select {
-		case <-c.stopCh:
+		case <-done:
 			return
 		case <-ticker.C:
 			// Bayeux heartbeat: empty array + connect
@@ -273,22 +587,49 @@ func (c *Client) heartbeatLoop(timeout int) {
 	}
 }
 
+// Status is a snapshot of the connection for status pages.
+type Status struct {
+	Running       bool     `json:"running"`
+	Connected     bool     `json:"connected"`
+	ClientID      string   `json:"clientId"`
+	Target        string   `json:"target,omitempty"`        // 登记的订阅目标 courseId/signId
+	Subscriptions []string `json:"subscriptions,omitempty"` // 服务端已确认的订阅频道
+}
+
+// Status returns the current connection state.
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Status{
+		Running:       c.running,
+		Connected:     c.connected,
+		ClientID:      c.clientID,
+		Target:        c.subscribed,
+		Subscriptions: append([]string(nil), c.subscriptions...),
+	}
+}
+
 // Attach subscribes to specific course/sign QR channel; safe to call multiple times.
 func (c *Client) Attach(courseID, signID int) {
 	key := fmt.Sprintf("%d/%d", courseID, signID)
+	c.mu.Lock()
 	if c.subscribed == key || courseID == 0 || signID == 0 {
+		c.mu.Unlock()
 		return
 	}
 	// 记录期望订阅的目标
 	c.subscribed = key
+	clientID := c.clientID
+	ready := c.connected && clientID != ""
+	c.mu.Unlock()
 	// 若已连接则立即订阅；否则等待 /meta/connect 成功后自动订阅
-	if !c.connected || c.clientID == "" {
-		infoln("[WS] connect 尚未完成，延迟订阅:", key)
+	if !ready {
+		c.log.Info("connect 尚未完成，延迟订阅", "target", key)
 		return
 	}
 	c.send([]any{map[string]any{
 		"channel":      "/meta/subscribe",
-		"clientId":     c.clientID,
+		"clientId":     clientID,
 		"subscription": fmt.Sprintf("/attendance/%d/%d/qr", courseID, signID),
 		"id":           c.nextSeq(),
 	}})
@@ -300,17 +641,35 @@ func (c *Client) send(payload any) {
 	if c.conn == nil {
 		return
 	}
-	_ = c.conn.WriteJSON(payload)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		c.log.Debug("marshal error", "err", err)
+		return
+	}
+	c.recordFrame(dirOut, data)
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout))
+	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		// 写失败通常意味着连接已断开，关闭后由读循环触发重连
+		c.log.Debug("write error", "err", err)
+		_ = c.conn.Close()
+	}
 }
 
-// rehandshake sends a fresh handshake per server advice and resets state
+// rehandshake sends a fresh handshake per server advice and resets state.
+// 已登记的订阅目标保留，connect 成功后会自动重新订阅。
 func (c *Client) rehandshake() {
 	c.mu.Lock()
 	c.clientID = ""
 	c.connected = false
-	c.subscribed = ""
+	c.subscriptions = nil
 	c.handshakeDone = make(chan struct{})
 	c.mu.Unlock()
+	metrics.WSRehandshakes.Inc()
+	c.sendHandshake()
+	c.log.Info("re-handshake sent")
+}
+
+func (c *Client) sendHandshake() {
 	c.send([]any{map[string]any{
 		"channel":        "/meta/handshake",
 		"version":        "1.0",
@@ -320,7 +679,6 @@ func (c *Client) rehandshake() {
 		},
 		"id": c.nextSeq(),
 	}})
-	infoln("[WS] re-handshake sent")
 }
 
 var qrChanRe = regexp.MustCompile(`^/attendance/\d+/\d+/qr$`)
@@ -331,17 +689,27 @@ func isQRChannel(ch string) bool {
 
 func (c *Client) handleQRMessage(m map[string]any) {
 	// Expect m["data"].(map), with type == 1 and qrUrl string
+	ch := strOf(m["channel"])
 	data, _ := m["data"].(map[string]any)
 	if data == nil {
+		c.unknown(MissingField, ch, m)
 		return
 	}
 	// type: 1=code, 3=student
 	t, _ := data["type"].(float64)
 	if int(t) == 1 {
 		if url, ok := data["qrUrl"].(string); ok && url != "" {
-			// Render QR in terminal
-			infof("[QR] 刷新二维码 @ %s\n", time.Now().Format(time.RFC3339))
-			qr.Print(url)
+			courseID, signID, r := c.timeline.record(ch, url, time.Now())
+			c.log.Info("刷新二维码", "signId", signID, "hash", r.Hash, "interval_ms", r.IntervalMS)
+			if r.Anomaly != "" {
+				c.log.Warn("二维码推送异常", "anomaly", r.Anomaly, "signId", signID, "hash", r.Hash, "interval_ms", r.IntervalMS)
+				metrics.QRAnomalies.Inc(r.Anomaly)
+			}
+			metrics.QRRefreshes.Inc()
+			c.events.Publish(events.QRRefreshed, map[string]any{
+				"courseId": courseID, "signId": signID, "hash": r.Hash,
+				"intervalMs": r.IntervalMS, "anomaly": r.Anomaly,
+			})
 			// 非阻塞发送二维码链接
 			select {
 			case c.QrURLCh <- url:
@@ -352,7 +720,9 @@ func (c *Client) handleQRMessage(m map[string]any) {
 				}
 				c.QrURLCh <- url
 			}
+			return
 		}
+		c.unknown(MissingField, ch, m)
 		return
 	}
 	if int(t) == 3 {
@@ -364,13 +734,24 @@ func (c *Client) handleQRMessage(m map[string]any) {
 				Rank:          intOf(stu["rank"]),
 				ID:            int64Of(stu["id"]),
 			}
-			infof("[QR] 学生签到结果: name=%s number=%s rank=%d id=%d\n", res.Name, res.StudentNumber, res.Rank, res.ID)
+			// 登记为敏感标识，后续日志/录制中统一遮蔽
+			redact.Add(redact.KindName, res.Name)
+			redact.Add(redact.KindStudentNumber, res.StudentNumber)
+			if c.opts.OwnResult != nil && !c.opts.OwnResult(res) {
+				c.log.Debug("其他同学的签到结果", "name", res.Name, "rank", res.Rank)
+				return
+			}
+			c.log.Info("学生签到结果", "name", res.Name, "number", res.StudentNumber, "rank", res.Rank, "id", res.ID)
 			select { // 非阻塞发送，避免无人接收卡住
 			case c.ResultCh <- res:
 			default:
 			}
+			return
 		}
+		c.unknown(MissingField, ch, m)
+		return
 	}
+	c.unknown(UnknownType, ch, m)
 }
 
 type StudentResult struct {
@@ -380,6 +761,13 @@ type StudentResult struct {
 	Rank          int
 }
 
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
 func strOf(v any) string {
 	if s, ok := v.(string); ok {
 		return s
@@ -0,0 +1,176 @@
+package qrws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fayeStub is a minimal Bayeux server: it acknowledges handshake/connect/subscribe/disconnect
+// and counts the /meta/disconnect messages it receives.
+type fayeStub struct {
+	srv         *httptest.Server
+	disconnects atomic.Int32
+	// disconnectDelay 推迟 /meta/disconnect 的应答，使 Close 停在等待应答处
+	disconnectDelay time.Duration
+}
+
+func newFayeStub(t *testing.T) *fayeStub {
+	t.Helper()
+	f := &fayeStub{}
+	up := websocket.Upgrader{
+		Subprotocols: []string{"bayeux"},
+		CheckOrigin: func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "https://www.teachermate.com.cn"
+		},
+	}
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msgs []map[string]any
+			if json.Unmarshal(data, &msgs) != nil {
+				continue
+			}
+			reply := []map[string]any{}
+			for _, m := range msgs {
+				ch, _ := m["channel"].(string)
+				ack := map[string]any{"channel": ch, "successful": true, "id": m["id"]}
+				switch ch {
+				case "/meta/handshake":
+					ack["clientId"] = "stub-client"
+				case "/meta/connect":
+					ack["advice"] = map[string]any{"timeout": 60000}
+				case "/meta/subscribe":
+					ack["subscription"] = m["subscription"]
+				case "/meta/disconnect":
+					f.disconnects.Add(1)
+					time.Sleep(f.disconnectDelay)
+				}
+				reply = append(reply, ack)
+			}
+			out, _ := json.Marshal(reply)
+			if err := conn.WriteMessage(websocket.TextMessage, out); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fayeStub) endpoint() string {
+	return "ws" + strings.TrimPrefix(f.srv.URL, "http")
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloseThenStartLeaksNoGoroutines(t *testing.T) {
+	f := newFayeStub(t)
+	c := NewWithOptions(Options{Endpoint: f.endpoint()})
+	baseline := runtime.NumGoroutine()
+
+	for round := 1; round <= 2; round++ {
+		if err := c.Start(); err != nil {
+			t.Fatalf("round %d: start: %v", round, err)
+		}
+		waitFor(t, "connect", func() bool { return c.Status().Connected })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := c.Close(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("round %d: close: %v", round, err)
+		}
+		if got := f.disconnects.Load(); got != int32(round) {
+			t.Fatalf("round %d: /meta/disconnect received %d times", round, got)
+		}
+		if st := c.Status(); st.Running || st.Connected || st.ClientID != "" {
+			t.Fatalf("round %d: status after close = %+v", round, st)
+		}
+	}
+
+	// 服务端处理协程在连接关闭后退出，给它一点时间
+	waitFor(t, "goroutines to return to baseline", func() bool {
+		return runtime.NumGoroutine() <= baseline
+	})
+}
+
+func TestCloseRightAfterStartReturnsPromptly(t *testing.T) {
+	f := newFayeStub(t)
+	// 读超时很长：若 Close 之后仍接管了新连接，Close 会一直等到超时
+	c := NewWithOptions(Options{Endpoint: f.endpoint(), ReadTimeout: time.Minute})
+	for i := 0; i < 20; i++ {
+		if err := c.Start(); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err := c.Close(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("iteration %d: %v", i, err)
+		}
+	}
+}
+
+func TestStartDuringCloseWaitsForClose(t *testing.T) {
+	f := newFayeStub(t)
+	f.disconnectDelay = 300 * time.Millisecond
+	c := NewWithOptions(Options{Endpoint: f.endpoint()})
+	baseline := runtime.NumGoroutine()
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "connect", func() bool { return c.Status().Connected })
+
+	closeErr := make(chan error, 1)
+	go func() { closeErr <- c.Close(context.Background()) }()
+	// Close 已发出 disconnect，正在等待应答
+	waitFor(t, "disconnect sent", func() bool { return f.disconnects.Load() == 1 })
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-closeErr:
+		if err != nil {
+			t.Fatalf("first close: %v", err)
+		}
+	default:
+		t.Fatal("Start returned before the pending Close finished")
+	}
+
+	// 新的会话不受旧 Close 影响：能连上，也能再次正常关闭
+	waitFor(t, "reconnect", func() bool { return c.Status().Connected })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+	waitFor(t, "goroutines to return to baseline", func() bool {
+		return runtime.NumGoroutine() <= baseline
+	})
+}
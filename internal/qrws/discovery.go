@@ -0,0 +1,195 @@
+package qrws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/metrics"
+)
+
+// Reasons for capturing a message.
+const (
+	UnknownChannel = "unknown_channel" // 非 /meta/*、非二维码频道的消息
+	UnknownType    = "unknown_type"    // 二维码频道中 data.type 不是 1/3
+	MissingField   = "missing_field"   // 已知类型但缺少 qrUrl/student 等字段
+)
+
+// Unknown describes one message kind the client does not understand.
+type Unknown struct {
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"`        // 频道，数字段替换为 *，便于归类
+	Type    string    `json:"type,omitempty"` // data.type（若有）
+	Reason  string    `json:"reason"`
+	Keys    []string  `json:"keys"`   // data 的键（无 data 时为消息本身的键）
+	Sample  string    `json:"sample"` // 脱敏、截断后的样例 JSON
+	Count   int       `json:"count"`  // 本进程内同类消息出现的次数（写入日志时为 1）
+}
+
+// Discovery appends the first occurrence of each unknown message kind to a JSONL file
+// and counts repeats, so new server pushes can be identified from real sessions.
+type Discovery struct {
+	mu     sync.Mutex
+	f      *os.File
+	seen   map[string]*Unknown
+	redact func(string) string
+}
+
+// NewDiscovery opens (or creates) path in append mode; an empty path only counts in memory.
+func NewDiscovery(path string) (*Discovery, error) {
+	d := &Discovery{seen: map[string]*Unknown{}}
+	if path == "" {
+		return d, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open ws discovery file: %w", err)
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("chmod ws discovery file: %w", err)
+	}
+	d.f = f
+	return d, nil
+}
+
+// SetRedactor masks identifiers in captured samples.
+func (d *Discovery) SetRedactor(fn func(string) string) {
+	d.mu.Lock()
+	d.redact = fn
+	d.mu.Unlock()
+}
+
+var digitsRe = regexp.MustCompile(`/\d+`)
+
+// capture records m; first reports whether this kind was seen for the first time.
+// Only the first occurrence is written to the file.
+func (d *Discovery) capture(reason, channel string, m map[string]any) (u Unknown, first bool, err error) {
+	u = Unknown{Time: time.Now(), Channel: digitsRe.ReplaceAllString(channel, "/*"), Reason: reason}
+	body := m
+	if data, ok := m["data"].(map[string]any); ok {
+		body = data
+		if t, ok := data["type"]; ok {
+			u.Type = fmt.Sprint(t)
+		}
+	}
+	for k := range body {
+		u.Keys = append(u.Keys, k)
+	}
+	sort.Strings(u.Keys)
+	key := strings.Join([]string{u.Reason, u.Channel, u.Type, strings.Join(u.Keys, ",")}, "|")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if prev, ok := d.seen[key]; ok {
+		prev.Count++
+		return *prev, false, nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // 保留 "<string>" 等占位符的可读性
+	_ = enc.Encode(sanitize(m))
+	s := strings.TrimSpace(buf.String())
+	if d.redact != nil {
+		s = d.redact(s)
+	}
+	if len(s) > 2048 {
+		// 按字节截断时回退到字符边界，避免写出非法 UTF-8
+		n := 2048
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n] + "…"
+	}
+	u.Sample, u.Count = s, 1
+	d.seen[key] = &u
+	if d.f != nil {
+		line, _ := json.Marshal(u)
+		_, err = d.f.Write(append(line, '\n'))
+	}
+	return u, true, err
+}
+
+// Seen returns every unknown kind met so far with its count.
+func (d *Discovery) Seen() []Unknown {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Unknown, 0, len(d.seen))
+	for _, u := range d.seen {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+// Close closes the file.
+func (d *Discovery) Close() error {
+	if d == nil || d.f == nil {
+		return nil
+	}
+	return d.f.Close()
+}
+
+// 这些键的值可能是身份信息或一次性链接，样例中只保留类型
+var sensitiveKey = regexp.MustCompile(`(?i)name|number|openid|phone|mobile|url|token|id$`)
+
+// sanitize keeps the structure of v while hiding values that may identify someone:
+// sensitive keys become "<type>" and long strings are cut to 64 characters.
+func sanitize(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, val := range x {
+			if sensitiveKey.MatchString(k) && k != "channel" {
+				out[k] = fmt.Sprintf("<%T>", val)
+				continue
+			}
+			out[k] = sanitize(val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, val := range x {
+			out[i] = sanitize(val)
+		}
+		return out
+	case string:
+		if r := []rune(x); len(r) > 64 {
+			return string(r[:64]) + "…"
+		}
+	}
+	return v
+}
+
+// UnknownMessages returns the unknown message kinds met since the client was created.
+func (c *Client) UnknownMessages() []Unknown {
+	return c.discovery.Seen()
+}
+
+// unknown captures a message the client cannot handle, logs and publishes new kinds.
+func (c *Client) unknown(reason, channel string, m map[string]any) {
+	metrics.WSUnknownMessages.Inc(reason)
+	u, first, err := c.discovery.capture(reason, channel, m)
+	if err != nil {
+		c.log.Warn("write ws discovery log", "err", err)
+	}
+	if !first {
+		c.log.Debug("未识别的 WS 消息（同类已记录）", "reason", reason, "channel", u.Channel, "type", u.Type, "count", u.Count)
+		return
+	}
+	c.log.Warn("未识别的 WS 消息", "reason", reason, "channel", u.Channel, "type", u.Type, "keys", u.Keys)
+	c.events.Publish(events.WSUnknown, map[string]any{
+		"reason": reason, "channel": u.Channel, "type": u.Type, "keys": u.Keys, "sample": u.Sample,
+	})
+}
@@ -0,0 +1,51 @@
+package qrws
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDiscoveryCapture(t *testing.T) {
+	d, err := NewDiscovery("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]any{
+		"channel": "/attendance/12/34/qr",
+		"data":    map[string]any{"type": float64(7), "studentName": "张三", "note": "hi"},
+	}
+	u, first, err := d.capture(UnknownType, "/attendance/12/34/qr", m)
+	if err != nil || !first {
+		t.Fatalf("first capture = %v, %v", first, err)
+	}
+	if u.Channel != "/attendance/*/*/qr" || u.Type != "7" || strings.Join(u.Keys, ",") != "note,studentName,type" {
+		t.Fatalf("captured %+v", u)
+	}
+	if strings.Contains(u.Sample, "张三") || !strings.Contains(u.Sample, `"studentName":"<string>"`) {
+		t.Fatalf("sample not sanitized: %s", u.Sample)
+	}
+	m["data"].(map[string]any)["studentName"] = "李四"
+	if u, first, _ := d.capture(UnknownType, "/attendance/56/78/qr", m); first || u.Count != 2 {
+		t.Fatalf("repeat capture = %+v, first=%v", u, first)
+	}
+}
+
+func TestDiscoverySampleTruncatesOnRuneBoundary(t *testing.T) {
+	d, _ := NewDiscovery("")
+	// 大量短的多字节字符串：单个值不触发 64 字符截断，但整体超过 2KB
+	data := map[string]any{"type": float64(9)}
+	for i := 0; i < 200; i++ {
+		data[strings.Repeat("k", i%7+1)+string(rune('a'+i%26))+strings.Repeat("x", i/26)] = "中文样例"
+	}
+	for shift := 0; shift < 16; shift++ {
+		m := map[string]any{"channel": "/x" + strings.Repeat("y", shift), "data": data}
+		u, _, _ := d.capture(UnknownChannel, m["channel"].(string), m)
+		if !utf8.ValidString(u.Sample) {
+			t.Fatalf("shift %d: sample is not valid UTF-8", shift)
+		}
+		if !strings.HasSuffix(u.Sample, "…") || len(u.Sample) > 2048+len("…") {
+			t.Fatalf("shift %d: sample length %d", shift, len(u.Sample))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package qrws
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	dirIn  = "in"
+	dirOut = "out"
+)
+
+// Frame is one recorded WebSocket frame, stored as a JSONL line.
+type Frame struct {
+	Time string `json:"ts"`  // RFC3339Nano
+	Dir  string `json:"dir"` // "in" 服务端推送 / "out" 客户端发送
+	// Data 为合法 JSON 时原样保存，否则存入 Text
+	Data json.RawMessage `json:"frame,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+// Recorder appends every inbound/outbound Bayeux frame to a JSONL file.
+type Recorder struct {
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	redact func(string) string
+}
+
+// NewRecorder opens (or creates) path in append mode.
+func NewRecorder(path string) (*Recorder, error) {
+	// 帧里有签到链接和（未脱敏时的）学生信息，只允许本人读写；旧版本建的 0644 文件也一并收紧
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open ws record file: %w", err)
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("chmod ws record file: %w", err)
+	}
+	return &Recorder{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// SetRedactor masks identifiers (openid, student number, name) in every recorded frame.
+func (r *Recorder) SetRedactor(fn func(string) string) {
+	r.mu.Lock()
+	r.redact = fn
+	r.mu.Unlock()
+}
+
+// Record writes a frame; each line is flushed immediately so crashes keep everything up to that point.
+func (r *Recorder) Record(dir string, data []byte) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.redact != nil {
+		data = []byte(r.redact(string(data)))
+	}
+	fr := Frame{Time: time.Now().Format(time.RFC3339Nano), Dir: dir}
+	if json.Valid(data) {
+		fr.Data = json.RawMessage(data)
+	} else {
+		fr.Text = string(data)
+	}
+	line, err := json.Marshal(fr)
+	if err != nil {
+		return err
+	}
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return r.w.Flush()
+}
+
+// Close flushes and closes the underlying file.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		_ = r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+func (c *Client) recordFrame(dir string, data []byte) {
+	if err := c.recorder.Record(dir, data); err != nil {
+		c.log.Debug("record error", "err", err)
+	}
+}
+
+// ReadFrames parses a recording produced by Recorder.
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	var out []Frame
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var fr Frame
+		if err := json.Unmarshal(sc.Bytes(), &fr); err != nil {
+			return out, fmt.Errorf("record line %d: %w", line, err)
+		}
+		out = append(out, fr)
+	}
+	return out, sc.Err()
+}
+
+// Replay feeds the inbound frames of a recording through the client's message handling,
+// without a network connection: outbound sends are dropped, heartbeats are not started and
+// advice intervals are not slept, so a past session re-runs deterministically.
+// 回放结果通过 ResultCh / QrURLCh 与日志观察；返回处理的入站帧数量。
+func (c *Client) Replay(r io.Reader) (int, error) {
+	frames, err := ReadFrames(r)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	if c.running {
+		c.mu.Unlock()
+		return 0, fmt.Errorf("qrws replay: client is running")
+	}
+	c.replaying = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.replaying = false
+		c.mu.Unlock()
+	}()
+	done := make(chan struct{})
+	defer close(done)
+	n := 0
+	for _, fr := range frames {
+		if fr.Dir != dirIn {
+			continue
+		}
+		data := []byte(fr.Data)
+		if len(data) == 0 {
+			data = []byte(fr.Text)
+		}
+		c.handleFrame(data, done)
+		n++
+	}
+	return n, nil
+}
+
+// ReplayFile is a convenience wrapper around Replay for tests and the replay subcommand.
+func ReplayFile(path string, opts Options) (*Client, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	c := NewWithOptions(opts)
+	n, err := c.Replay(f)
+	return c, n, err
+}
@@ -0,0 +1,104 @@
+package qrws
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+)
+
+func TestReplayFileSession(t *testing.T) {
+	bus := events.NewBus()
+	sub, unsubscribe := bus.Subscribe(32)
+	defer unsubscribe()
+
+	c, n, err := ReplayFile("testdata/session.jsonl", Options{Events: bus})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 9 {
+		t.Fatalf("replayed %d inbound frames, want 9", n)
+	}
+
+	st := c.Status()
+	if !st.Connected || st.ClientID != "replay-client-1" {
+		t.Fatalf("status = %+v, want connected as replay-client-1", st)
+	}
+	if len(st.Subscriptions) != 1 || st.Subscriptions[0] != "/attendance/1234/5678/qr" {
+		t.Fatalf("subscriptions = %v", st.Subscriptions)
+	}
+
+	// QrURLCh 只保留最新的二维码
+	select {
+	case url := <-c.QrURLCh:
+		if url != "https://www.teachermate.com.cn/api/v1/qr/checkin?t=ccc333" {
+			t.Fatalf("latest qr = %q", url)
+		}
+	default:
+		t.Fatal("no qr url emitted")
+	}
+	select {
+	case res := <-c.ResultCh:
+		want := StudentResult{ID: 987654, Name: "测试同学", StudentNumber: "20260001", Rank: 7}
+		if res != want {
+			t.Fatalf("student result = %+v, want %+v", res, want)
+		}
+	default:
+		t.Fatal("no student result emitted")
+	}
+
+	var kinds []string
+	var anomalies []any
+	for len(sub) > 0 {
+		e := <-sub
+		kinds = append(kinds, e.Kind)
+		if e.Kind == events.QRRefreshed {
+			if e.Fields["courseId"] != 1234 || e.Fields["signId"] != 5678 {
+				t.Fatalf("qr_refreshed fields = %v", e.Fields)
+			}
+			anomalies = append(anomalies, e.Fields["anomaly"])
+		}
+	}
+	wantKinds := []string{events.WSConnected, events.QRRefreshed, events.QRRefreshed, events.QRRefreshed, events.QRRefreshed}
+	if len(kinds) != len(wantKinds) {
+		t.Fatalf("events = %v, want %v", kinds, wantKinds)
+	}
+	for i := range wantKinds {
+		if kinds[i] != wantKinds[i] {
+			t.Fatalf("events = %v, want %v", kinds, wantKinds)
+		}
+	}
+	// 第三次推送重复了第二次的二维码
+	if anomalies[2] != AnomalyDuplicate {
+		t.Fatalf("anomalies = %v, want duplicate on the third push", anomalies)
+	}
+	if got := c.UnknownMessages(); len(got) != 0 {
+		t.Fatalf("unexpected unknown messages: %+v", got)
+	}
+
+	tl := c.QRTimelines()
+	if len(tl) != 1 || tl[0].SignID != 5678 || len(tl[0].Refreshes) != 4 || tl[0].Distinct != 3 {
+		t.Fatalf("timeline = %+v", tl)
+	}
+}
+
+func TestRecorderFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws.jsonl")
+	// 旧版本留下的 0644 文件也要被收紧
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Fatalf("record file mode = %o, want 600", mode)
+	}
+}
@@ -0,0 +1,157 @@
+package qrws
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 每个签到最多保留的刷新记录数，以及保留的签到个数
+const (
+	timelineMaxRefreshes = 500
+	timelineMaxSigns     = 5
+)
+
+// Anomalies detected on a type=1 push.
+const (
+	AnomalyDuplicate  = "duplicate"    // 与上一次推送的二维码相同
+	AnomalyOutOfOrder = "out_of_order" // 重新推送了更早的二维码
+	AnomalyGap        = "gap"          // 间隔超过中位数的 3 倍（漏推或断线）
+)
+
+// QRRefresh is one type=1 push. The URL itself is not kept, only a short hash.
+type QRRefresh struct {
+	Time       time.Time `json:"time"`
+	Hash       string    `json:"hash"`
+	IntervalMS int64     `json:"intervalMs"` // 距上一次推送，首个为 0
+	Anomaly    string    `json:"anomaly,omitempty"`
+}
+
+// SignTimeline is the refresh history of one sign's QR channel.
+type SignTimeline struct {
+	CourseID         int         `json:"courseId"`
+	SignID           int         `json:"signId"`
+	Refreshes        []QRRefresh `json:"refreshes"`
+	Distinct         int         `json:"distinct"` // 不同二维码的个数
+	MedianIntervalMS int64       `json:"medianIntervalMs"`
+	MinIntervalMS    int64       `json:"minIntervalMs"`
+	MaxIntervalMS    int64       `json:"maxIntervalMs"`
+	Anomalies        int         `json:"anomalies"`
+}
+
+var qrChanIDsRe = regexp.MustCompile(`^/attendance/(\d+)/(\d+)/qr$`)
+
+// qrTimeline tracks refreshes per QR channel, newest sign last.
+type qrTimeline struct {
+	mu    sync.Mutex
+	signs []*SignTimeline
+	seen  map[*SignTimeline]map[string]int // hash -> 最近一次出现的下标
+}
+
+func newQRTimeline() *qrTimeline {
+	return &qrTimeline{seen: map[*SignTimeline]map[string]int{}}
+}
+
+// record adds a push on channel and returns it with its interval and anomaly.
+func (t *qrTimeline) record(channel, url string, now time.Time) (courseID, signID int, r QRRefresh) {
+	if m := qrChanIDsRe.FindStringSubmatch(channel); m != nil {
+		courseID, _ = strconv.Atoi(m[1])
+		signID, _ = strconv.Atoi(m[2])
+	}
+	sum := sha256.Sum256([]byte(url))
+	r = QRRefresh{Time: now, Hash: hex.EncodeToString(sum[:6])}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.sign(courseID, signID)
+	seen := t.seen[st]
+	if n := len(st.Refreshes); n > 0 {
+		prev := st.Refreshes[n-1]
+		r.IntervalMS = now.Sub(prev.Time).Milliseconds()
+		if i, ok := seen[r.Hash]; ok {
+			if i == n-1 {
+				r.Anomaly = AnomalyDuplicate
+			} else {
+				r.Anomaly = AnomalyOutOfOrder
+			}
+		} else if st.MedianIntervalMS > 0 && len(st.Refreshes) >= 3 && r.IntervalMS > 3*st.MedianIntervalMS {
+			r.Anomaly = AnomalyGap
+		}
+	}
+	if len(st.Refreshes) >= timelineMaxRefreshes {
+		st.Refreshes = st.Refreshes[1:]
+		for h, i := range seen {
+			if i == 0 {
+				delete(seen, h)
+			} else {
+				seen[h] = i - 1
+			}
+		}
+	}
+	st.Refreshes = append(st.Refreshes, r)
+	if _, ok := seen[r.Hash]; !ok {
+		st.Distinct++
+	}
+	seen[r.Hash] = len(st.Refreshes) - 1
+	if r.Anomaly != "" {
+		st.Anomalies++
+	}
+	st.updateStats()
+	return courseID, signID, r
+}
+
+// sign returns the timeline of a sign, creating it (and dropping the oldest) as needed.
+func (t *qrTimeline) sign(courseID, signID int) *SignTimeline {
+	for _, st := range t.signs {
+		if st.CourseID == courseID && st.SignID == signID {
+			return st
+		}
+	}
+	if len(t.signs) >= timelineMaxSigns {
+		delete(t.seen, t.signs[0])
+		t.signs = t.signs[1:]
+	}
+	st := &SignTimeline{CourseID: courseID, SignID: signID}
+	t.signs = append(t.signs, st)
+	t.seen[st] = map[string]int{}
+	return st
+}
+
+// updateStats recomputes interval statistics over the non-duplicate pushes.
+func (st *SignTimeline) updateStats() {
+	var iv []int64
+	for _, r := range st.Refreshes[1:] {
+		if r.Anomaly != AnomalyDuplicate {
+			iv = append(iv, r.IntervalMS)
+		}
+	}
+	if len(iv) == 0 {
+		return
+	}
+	slices.Sort(iv)
+	st.MedianIntervalMS = iv[len(iv)/2]
+	st.MinIntervalMS = iv[0]
+	st.MaxIntervalMS = iv[len(iv)-1]
+}
+
+// snapshot copies all timelines, oldest sign first.
+func (t *qrTimeline) snapshot() []SignTimeline {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]SignTimeline, 0, len(t.signs))
+	for _, st := range t.signs {
+		c := *st
+		c.Refreshes = slices.Clone(st.Refreshes)
+		out = append(out, c)
+	}
+	return out
+}
+
+// QRTimelines returns the QR refresh history of the most recent signs.
+func (c *Client) QRTimelines() []SignTimeline {
+	return c.timeline.snapshot()
+}
@@ -0,0 +1,119 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kinds of identifiers that are masked.
+const (
+	KindOpenID        = "openid"
+	KindStudentNumber = "student_number"
+	KindName          = "name"
+	KindCredential    = "credential"
+)
+
+// Redactor masks registered secrets and well-known sensitive fields in free text.
+// Masks keep a short hash so different values stay distinguishable in logs:
+// "8f1d...c3" -> "[openid#1a2b3c]".
+type Redactor struct {
+	mu       sync.RWMutex
+	disabled bool
+	secrets  map[string]string // value -> mask
+	ordered  []string          // values, longest first
+}
+
+func New() *Redactor {
+	return &Redactor{secrets: map[string]string{}}
+}
+
+// std is the process-wide redactor shared by logging, recorders and error output.
+var std = New()
+
+func Default() *Redactor { return std }
+
+// Add registers a secret value of the given kind.
+func Add(kind, value string) { std.Add(kind, value) }
+
+// String masks all known identifiers in s.
+func String(s string) string { return std.String(s) }
+
+// SetEnabled turns masking on/off (off only with --unsafe-log).
+func SetEnabled(b bool) { std.SetEnabled(b) }
+
+func (r *Redactor) SetEnabled(b bool) {
+	r.mu.Lock()
+	r.disabled = !b
+	r.mu.Unlock()
+}
+
+func (r *Redactor) Add(kind, value string) {
+	value = strings.TrimSpace(value)
+	// 过短的值（如单字姓名）容易误伤正常文本，不登记
+	if len([]rune(value)) < 2 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.secrets[value]; ok {
+		return
+	}
+	r.secrets[value] = Mask(kind, value)
+	r.ordered = append(r.ordered, value)
+	sort.Slice(r.ordered, func(i, j int) bool { return len(r.ordered[i]) > len(r.ordered[j]) })
+}
+
+// Mask renders the placeholder for a value.
+func Mask(kind, value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "[" + kind + "#" + hex.EncodeToString(sum[:3]) + "]"
+}
+
+// 已知敏感字段：URL/表单参数、JSON 字段、日志 key=value
+var fieldPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{KindOpenID, regexp.MustCompile(`(?i)([?&#]openid=)([^&#\s"']+)`)},
+	{KindOpenID, regexp.MustCompile(`(?i)("openid"\s*:\s*")([^"]+)`)},
+	{KindOpenID, regexp.MustCompile(`(?i)(\bopenid[=:]\s*)([0-9A-Za-z_-]{16,})`)},
+	{KindStudentNumber, regexp.MustCompile(`("studentNumber"\s*:\s*")([^"]+)`)},
+	{KindStudentNumber, regexp.MustCompile(`(\b(?:number|studentNumber|student_number)=)([^\s"]+)`)},
+	// 认证头：HTTP 头部行、JSON 形式的头部表、日志 key=value
+	{KindCredential, regexp.MustCompile(`(?i)(\b(?:authorization|cookie|set-cookie):[ \t]*)([^\r\n]+)`)},
+	{KindCredential, regexp.MustCompile(`(?i)("(?:authorization|cookie|set-cookie)"\s*:\s*\[?\s*")([^"]+)`)},
+	{KindCredential, regexp.MustCompile(`(?i)(\b(?:authorization|cookie)=)("[^"]*"|[^\s"]+)`)},
+}
+
+func (r *Redactor) String(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.disabled || s == "" {
+		return s
+	}
+	for _, v := range r.ordered {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, r.secrets[v])
+		}
+	}
+	for _, p := range fieldPatterns {
+		s = p.re.ReplaceAllStringFunc(s, func(m string) string {
+			sub := p.re.FindStringSubmatch(m)
+			if strings.HasPrefix(sub[2], "[") {
+				// 已被字面量替换过
+				return m
+			}
+			return sub[1] + Mask(p.kind, sub[2])
+		})
+	}
+	return s
+}
+
+// Bytes is String for byte slices.
+func (r *Redactor) Bytes(b []byte) []byte {
+	return []byte(r.String(string(b)))
+}
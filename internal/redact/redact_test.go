@@ -0,0 +1,93 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+const openid = "0123456789abcdef0123456789abcdef"
+
+func TestFieldPatterns(t *testing.T) {
+	mOpenID := Mask(KindOpenID, openid)
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"query param", "GET https://v18.teachermate.cn/sign?openid=" + openid + "&x=1",
+			"GET https://v18.teachermate.cn/sign?openid=" + mOpenID + "&x=1"},
+		{"fragment param", "/#/sign?a=1&OPENID=" + openid, "/#/sign?a=1&OPENID=" + mOpenID},
+		{"json openid", `{"openid": "` + openid + `"}`, `{"openid": "` + mOpenID + `"}`},
+		{"log key=value", "session renewed openid=" + openid, "session renewed openid=" + mOpenID},
+		{"json student number", `{"studentNumber":"20260001","rank":7}`,
+			`{"studentNumber":"` + Mask(KindStudentNumber, "20260001") + `","rank":7}`},
+		{"log student number", "result number=20260001 rank=7",
+			"result number=" + Mask(KindStudentNumber, "20260001") + " rank=7"},
+		{"authorization header", "Authorization: Bearer abc.def\r\nAccept: */*",
+			"Authorization: " + Mask(KindCredential, "Bearer abc.def") + "\r\nAccept: */*"},
+		{"cookie header", "cookie: sid=1; token=2\n", "cookie: " + Mask(KindCredential, "sid=1; token=2") + "\n"},
+		{"set-cookie header", "Set-Cookie: sid=1; Path=/", "Set-Cookie: " + Mask(KindCredential, "sid=1; Path=/")},
+		{"json header map", `{"Authorization":"Bearer x","Cookie":["sid=1"]}`,
+			`{"Authorization":"` + Mask(KindCredential, "Bearer x") + `","Cookie":["` + Mask(KindCredential, "sid=1") + `"]}`},
+		{"log header attr", `req authorization="Bearer x" status=200`,
+			`req authorization=` + Mask(KindCredential, `"Bearer x"`) + ` status=200`},
+	}
+	r := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.String(tt.in); got != tt.want {
+				t.Fatalf("String(%q)\n got  %q\n want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNothingToRedact(t *testing.T) {
+	r := New()
+	r.Add(KindName, "测试同学")
+	for _, s := range []string{
+		"",
+		"no active sign",
+		`{"courseId":1234,"signId":5678,"name":"软件工程"}`,
+		"https://v18.teachermate.cn/wechat-api/v1/class-attendance/student/active_signs",
+		"openid=short", // 过短，不像 openid
+		"Accept: application/json\r\nUser-Agent: test",
+	} {
+		if got := r.String(s); got != s {
+			t.Errorf("String(%q) = %q, want unchanged", s, got)
+		}
+	}
+}
+
+func TestRegisteredValues(t *testing.T) {
+	r := New()
+	r.Add(KindName, "测试同学")
+	r.Add(KindStudentNumber, "20260001")
+	r.Add(KindOpenID, openid)
+	r.Add(KindName, "王") // 单字姓名不登记
+
+	in := "学生签到结果 测试同学 20260001 id=" + openid + " 王老师"
+	got := r.String(in)
+	for _, secret := range []string{"测试同学", "20260001", openid} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("%q leaked in %q", secret, got)
+		}
+	}
+	want := "学生签到结果 " + Mask(KindName, "测试同学") + " " + Mask(KindStudentNumber, "20260001") +
+		" id=" + Mask(KindOpenID, openid) + " 王老师"
+	if got != want {
+		t.Fatalf("got  %q\nwant %q", got, want)
+	}
+
+	r.SetEnabled(false)
+	if got := r.String(in); got != in {
+		t.Fatalf("disabled redactor changed the text: %q", got)
+	}
+}
+
+func TestMaskDistinguishesValues(t *testing.T) {
+	a, b := Mask(KindOpenID, openid), Mask(KindOpenID, strings.ToUpper(openid))
+	if a == b || !strings.HasPrefix(a, "[openid#") || len(a) != len("[openid#")+6+1 {
+		t.Fatalf("masks %q %q", a, b)
+	}
+}
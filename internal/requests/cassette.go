@@ -0,0 +1,358 @@
+package requests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CassetteMode selects whether the Recorder hits the network or serves from a cassette.
+type CassetteMode string
+
+const (
+	CassetteRecord CassetteMode = "record" // 真实请求并写入 cassette
+	CassetteReplay CassetteMode = "replay" // 不联网，按请求匹配 cassette 中的响应
+)
+
+// redactedOpenID replaces the openid everywhere in recorded exchanges.
+const redactedOpenID = "REDACTED_OPENID"
+
+// redactedCredential replaces the values of credentialHeaders.
+const redactedCredential = "REDACTED"
+
+// credentialHeaders are never stored verbatim (canonical header names).
+var credentialHeaders = map[string]bool{"Authorization": true, "Cookie": true, "Set-Cookie": true}
+
+// Interaction is one recorded request/response pair.
+type Interaction struct {
+	Time     string           `json:"time"`
+	Duration int64            `json:"duration_ms"`
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int               `json:"status_code"`
+	Status     string            `json:"status"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// Cassette holds the interactions of a cassette file. On disk each interaction is one
+// JSON line, so recording only appends; the older single-document format
+// ({"interactions": [...]}) is still read.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(path string) (*Cassette, error) {
+	cas, _, err := readCassette(path)
+	return cas, err
+}
+
+// readCassette also reports whether the file uses the older single-document format.
+func readCassette(path string) (cas *Cassette, legacy bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load cassette: %w", err)
+	}
+	cas = &Cassette{}
+	if json.Unmarshal(data, cas) == nil && cas.Interactions != nil {
+		return cas, true, nil
+	}
+	cas = &Cassette{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var it Interaction
+		if err := json.Unmarshal(sc.Bytes(), &it); err != nil {
+			return nil, false, fmt.Errorf("failed to load cassette: line %d: %w", line, err)
+		}
+		cas.Interactions = append(cas.Interactions, it)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to load cassette: %w", err)
+	}
+	return cas, false, nil
+}
+
+// Save writes the cassette as JSON lines atomically (temp file + rename).
+func (cas *Cassette) Save(path string) error {
+	var buf bytes.Buffer
+	for _, it := range cas.Interactions {
+		line, err := json.Marshal(it)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Recorder is an http.RoundTripper middleware that records exchanges to a cassette
+// or replays them without network access. The openid (from the openId header) is
+// redacted in URLs, headers and bodies before anything is stored or matched, and
+// Authorization/Cookie/Set-Cookie values are never stored.
+// 录制时只追加新行；同一请求连续得到相同响应（如全天轮询的空列表）只记录第一次。
+type Recorder struct {
+	mode CassetteMode
+	path string
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette // replay 模式下的全部交互
+	used     map[int]bool
+	f        *os.File          // record 模式下追加写入
+	last     map[string]string // 请求 -> 最近一次记录的响应，用于去重
+	redact   func(string) string
+	profile  func(*StudentProfile)
+}
+
+// SetRedactor applies an additional redaction (student number, name, ...) to recorded
+// exchanges, on top of the openid replacement.
+func (r *Recorder) SetRedactor(fn func(string) string) {
+	r.mu.Lock()
+	r.redact = fn
+	r.mu.Unlock()
+}
+
+// SetProfileHook registers fn to receive the profile parsed from a students response
+// before that response is redacted and stored. 第一次获取资料时姓名与学号尚未登记到脱敏器，
+// 由 fn 先登记，避免以明文写入 cassette。
+func (r *Recorder) SetProfileHook(fn func(*StudentProfile)) {
+	r.mu.Lock()
+	r.profile = fn
+	r.mu.Unlock()
+}
+
+// NewRecorder creates the middleware. In record mode an existing cassette is appended to;
+// in replay mode the cassette must exist. next defaults to http.DefaultTransport.
+func NewRecorder(path string, mode CassetteMode, next http.RoundTripper) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	r := &Recorder{mode: mode, path: path, next: next, cassette: &Cassette{}, used: map[int]bool{}, last: map[string]string{}}
+	switch mode {
+	case CassetteRecord:
+		if _, err := os.Stat(path); err == nil {
+			cas, legacy, err := readCassette(path)
+			if err != nil {
+				return nil, err
+			}
+			// 旧格式先整体转换为 JSONL，之后才能直接追加
+			if legacy {
+				if err := cas.Save(path); err != nil {
+					return nil, fmt.Errorf("failed to convert cassette: %w", err)
+				}
+			}
+			for _, it := range cas.Interactions {
+				r.last[interactionKey(it.Request)] = responseKey(it.Response)
+			}
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open cassette: %w", err)
+		}
+		r.f = f
+	case CassetteReplay:
+		cas, err := LoadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = cas
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q (record/replay)", mode)
+	}
+	return r, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	openid := req.Header.Get("openId")
+	var reqBody []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	rec := RecordedRequest{
+		Method:  req.Method,
+		URL:     redactOpenID(req.URL.String(), openid),
+		Headers: flattenHeader(req.Header, openid),
+		Body:    redactOpenID(string(reqBody), openid),
+	}
+	r.mu.Lock()
+	redact, profile := r.redact, r.profile
+	r.mu.Unlock()
+	if redact != nil {
+		rec.URL = redact(rec.URL)
+		rec.Body = redact(rec.Body)
+		for k, v := range rec.Headers {
+			rec.Headers[k] = redact(v)
+		}
+	}
+	if r.mode == CassetteReplay {
+		return r.replay(req, rec)
+	}
+
+	start := time.Now()
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	if profile != nil && resp.StatusCode == http.StatusOK && req.Method == http.MethodGet && strings.HasPrefix(req.URL.String(), studentsURL) {
+		var data [][]StudentField
+		if json.Unmarshal(respBody, &data) == nil {
+			profile(profileFromFields(data))
+		}
+	}
+
+	recResp := RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Headers:    flattenHeader(resp.Header, openid),
+		Body:       redactOpenID(string(respBody), openid),
+	}
+	if redact != nil {
+		recResp.Body = redact(recResp.Body)
+		for k, v := range recResp.Headers {
+			recResp.Headers[k] = redact(v)
+		}
+	}
+	key, val := interactionKey(rec), responseKey(recResp)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last[key] == val {
+		return resp, nil
+	}
+	line, err := json.Marshal(Interaction{
+		Time:     start.Format(time.RFC3339Nano),
+		Duration: time.Since(start).Milliseconds(),
+		Request:  rec,
+		Response: recResp,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 每次交互后立即追加，进程异常退出也不会丢失
+	if _, err := r.f.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to save cassette: %w", err)
+	}
+	r.last[key] = val
+	return resp, nil
+}
+
+// Close closes the cassette file in record mode.
+func (r *Recorder) Close() error {
+	if r == nil || r.f == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+func interactionKey(req RecordedRequest) string {
+	return req.Method + " " + req.URL + "\n" + req.Body
+}
+
+func responseKey(resp RecordedResponse) string {
+	return strconv.Itoa(resp.StatusCode) + "\n" + resp.Body
+}
+
+// replay serves the first unused interaction with the same method and URL; once all matching
+// interactions are used, the last one keeps being served (polling loops repeat requests).
+func (r *Recorder) replay(req *http.Request, rec RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := -1
+	for i, it := range r.cassette.Interactions {
+		if it.Request.Method != rec.Method || it.Request.URL != rec.URL {
+			continue
+		}
+		last = i
+		if !r.used[i] {
+			r.used[i] = true
+			return buildResponse(req, it.Response), nil
+		}
+	}
+	if last >= 0 {
+		return buildResponse(req, r.cassette.Interactions[last].Response), nil
+	}
+	return nil, fmt.Errorf("cassette %s: no interaction for %s %s", r.path, rec.Method, rec.URL)
+}
+
+func buildResponse(req *http.Request, rr RecordedResponse) *http.Response {
+	hdr := http.Header{}
+	for k, v := range rr.Headers {
+		hdr.Set(k, v)
+	}
+	status := rr.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", rr.StatusCode, http.StatusText(rr.StatusCode))
+	}
+	return &http.Response{
+		StatusCode:    rr.StatusCode,
+		Status:        status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        hdr,
+		Body:          io.NopCloser(strings.NewReader(rr.Body)),
+		ContentLength: int64(len(rr.Body)),
+		Request:       req,
+	}
+}
+
+func flattenHeader(h http.Header, openid string) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if credentialHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = redactedCredential
+			continue
+		}
+		out[k] = redactOpenID(strings.Join(v, ", "), openid)
+	}
+	return out
+}
+
+func redactOpenID(s, openid string) string {
+	if openid == "" || s == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, openid, redactedOpenID)
+}
@@ -0,0 +1,270 @@
+package requests
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/redact"
+)
+
+const testOpenID = "0123456789abcdef0123456789abcdef"
+
+func replayClient(t *testing.T, cassette string) *Client {
+	t.Helper()
+	rec, err := NewRecorder(filepath.Join("testdata", cassette), CassetteReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewWithTransport("test-agent", rec)
+}
+
+func TestReplayStudentSession(t *testing.T) {
+	cli := replayClient(t, "student.jsonl")
+
+	p, err := cli.GetStudentProfile(testOpenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "测试同学" || p.StudentNumber != "20260001" {
+		t.Fatalf("profile = %+v", p)
+	}
+	if p.Fields["class"] != "软件 2601" {
+		t.Fatalf("fields = %v", p.Fields)
+	}
+
+	// 第一次轮询没有签到，第二次出现一个 GPS 签到；之后重复最后一条
+	signs, err := cli.ActiveSigns(testOpenID)
+	if err != nil || len(signs) != 0 {
+		t.Fatalf("first poll = %v, %v", signs, err)
+	}
+	want := ActiveSign{CourseID: 1234, SignID: 5678, IsGPS: 1, Name: "软件工程"}
+	for i := 0; i < 2; i++ {
+		signs, err = cli.ActiveSigns(testOpenID)
+		if err != nil || len(signs) != 1 || signs[0] != want {
+			t.Fatalf("poll %d = %+v, %v", i+2, signs, err)
+		}
+	}
+
+	lon, lat := 113.3, 23.1
+	out, err := cli.SignIn(testOpenID, SignInQuery{CourseID: 1234, SignID: 5678, Lon: &lon, Lat: &lat})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["signRank"] != float64(7) {
+		t.Fatalf("sign in = %v", out)
+	}
+}
+
+func TestReplayUnauthorized(t *testing.T) {
+	cli := replayClient(t, "unauthorized.jsonl")
+
+	_, err := cli.GetStudentProfile(testOpenID)
+	var he *HTTPError
+	if !errors.As(err, &he) || he.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("err = %v, want HTTP 401", err)
+	}
+	if !IsUnauthorized(err) || ErrorType(err) != "unauthorized" {
+		t.Fatalf("IsUnauthorized(%v) = false", err)
+	}
+	if _, err := cli.ActiveSigns(testOpenID); !IsUnauthorized(err) {
+		t.Fatalf("active signs err = %v, want unauthorized", err)
+	}
+}
+
+func TestReplayMissingInteraction(t *testing.T) {
+	cli := replayClient(t, "unauthorized.jsonl")
+	if _, err := cli.SignIn(testOpenID, SignInQuery{CourseID: 1, SignID: 2}); err == nil {
+		t.Fatal("want error for a request not in the cassette")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestRecordAppendsAndDedupes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	polls := []string{"[]", "[]", "[]", `[{"courseId":1,"signId":2,"isGPS":0,"isQR":1,"name":"课程","code":""}]`}
+	n := 0
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := polls[n]
+		n++
+		return &http.Response{
+			StatusCode: 200,
+			Status:     "200 OK",
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+	rec, err := NewRecorder(path, CassetteRecord, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactor := func(s string) string { return strings.ReplaceAll(s, "active_signs", "ACTIVE") }
+	rec.SetRedactor(redactor)
+	cli := NewWithTransport("test-agent", rec)
+	for range polls {
+		if _, err := cli.ActiveSigns(testOpenID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), testOpenID) {
+		t.Fatal("openid leaked into cassette")
+	}
+	cas, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 连续三次相同的空列表只记录一次
+	if len(cas.Interactions) != 2 {
+		t.Fatalf("recorded %d interactions, want 2", len(cas.Interactions))
+	}
+	for _, it := range cas.Interactions {
+		if !strings.HasSuffix(it.Request.URL, "/ACTIVE") {
+			t.Fatalf("url not redacted: %s", it.Request.URL)
+		}
+		if it.Request.Headers["Openid"] != redactedOpenID {
+			t.Fatalf("openId header = %q", it.Request.Headers["Openid"])
+		}
+	}
+
+	// 再次以 record 模式打开时继续追加，且沿用已记录的响应去重
+	rec, err = NewRecorder(path, CassetteRecord, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.SetRedactor(redactor)
+	n = 3
+	if _, err := NewWithTransport("test-agent", rec).ActiveSigns(testOpenID); err != nil {
+		t.Fatal(err)
+	}
+	rec.Close()
+	if cas, _ := LoadCassette(path); len(cas.Interactions) != 2 {
+		t.Fatalf("reopened recorder wrote a duplicate: %d interactions", len(cas.Interactions))
+	}
+}
+
+func TestLoadLegacyCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.json")
+	legacy := `{
+  "interactions": [
+    {
+      "time": "2026-10-01T08:00:00+08:00",
+      "request": {"method": "GET", "url": "https://v18.teachermate.cn/wechat-api/v1/class-attendance/student/active_signs"},
+      "response": {"status_code": 200, "body": "[]"}
+    }
+  ]
+}`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// record 模式会把旧格式转换为 JSONL 再追加
+	rec, err := NewRecorder(path, CassetteRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Close()
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 1 || !strings.HasPrefix(string(data), `{"time"`) {
+		t.Fatalf("converted cassette = %q", data)
+	}
+	rec, err = NewRecorder(path, CassetteReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signs, err := NewWithTransport("test-agent", rec).ActiveSigns(testOpenID); err != nil || len(signs) != 0 {
+		t.Fatalf("replay converted cassette = %v, %v", signs, err)
+	}
+}
+
+func TestRecordRedactsFirstProfileAndHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	profileBody := `[[{"item_name":"name","item_value":"测试同学"},{"item_name":"student_number","item_value":"20260001"}]]`
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Status:     "200 OK",
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+				"Set-Cookie":   []string{"sid=s3cr3t; Path=/"},
+				"X-Student":    []string{"测试同学"},
+			},
+			Body:    io.NopCloser(strings.NewReader(profileBody)),
+			Request: req,
+		}, nil
+	})
+	rec, err := NewRecorder(path, CassetteRecord, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 与 main 相同：脱敏器起初不知道姓名学号，由资料钩子在写入前登记
+	r := redact.New()
+	rec.SetRedactor(r.String)
+	rec.SetProfileHook(func(p *StudentProfile) {
+		r.Add(redact.KindName, p.Name)
+		r.Add(redact.KindStudentNumber, p.StudentNumber)
+	})
+	cli := NewWithTransport("test-agent", rec)
+	req, _ := http.NewRequest("GET", studentsURL, nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	req.Header.Set("openId", testOpenID)
+	if _, err := rec.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	p, err := cli.GetStudentProfile(testOpenID)
+	if err != nil || p.Name != "测试同学" {
+		t.Fatalf("profile = %+v, %v", p, err) // 调用方拿到的仍是原文
+	}
+	rec.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"测试同学", "20260001", "s3cr3t", "Bearer tok", testOpenID} {
+		if strings.Contains(string(data), secret) {
+			t.Fatalf("%q stored in cassette:\n%s", secret, data)
+		}
+	}
+	cas, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := cas.Interactions[0]
+	if it.Response.Headers["Set-Cookie"] != redactedCredential || it.Request.Headers["Authorization"] != redactedCredential {
+		t.Fatalf("credential headers = %q / %q", it.Response.Headers["Set-Cookie"], it.Request.Headers["Authorization"])
+	}
+	if it.Response.Headers["X-Student"] != redact.Mask(redact.KindName, "测试同学") {
+		t.Fatalf("response header not redacted: %q", it.Response.Headers["X-Student"])
+	}
+}
+
+func TestRecordFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	rec, err := NewRecorder(path, CassetteRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Close()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Fatalf("cassette mode = %o, want 600", mode)
+	}
+}
@@ -0,0 +1,59 @@
+package requests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// HTTPError is returned by doJSON for status codes >= 400.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Status)
+}
+
+// ErrNoProfile means v2/students answered but without a name, which happens for stale openids.
+var ErrNoProfile = errors.New("can't find name")
+
+// IsUnauthorized reports whether err means the openid is no longer accepted
+// (HTTP 401/403, or an empty profile).
+func IsUnauthorized(err error) bool {
+	if errors.Is(err, ErrNoProfile) {
+		return true
+	}
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.StatusCode == http.StatusUnauthorized || he.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// ErrorType classifies err for metrics: unauthorized, http, timeout, network, decode or other.
+func ErrorType(err error) string {
+	if IsUnauthorized(err) {
+		return "unauthorized"
+	}
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return "http"
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		if ne.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &se) || errors.As(err, &te) {
+		return "decode"
+	}
+	return "other"
+}
@@ -6,14 +6,20 @@ import (
 	_ "errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/metrics"
 )
 
 // Client wraps http.Client allowing custom UA.
 type Client struct {
 	httpClient *http.Client
 	UserAgent  string
+	log        *slog.Logger
 }
 
 // Data models
@@ -44,11 +50,26 @@ type StudentField struct {
 }
 
 func New(userAgent string) *Client {
+	return NewWithTransport(userAgent, nil)
+}
+
+// NewWithTransport allows wrapping the HTTP transport, e.g. with a cassette Recorder.
+// A nil transport uses http.DefaultTransport.
+func NewWithTransport(userAgent string, rt http.RoundTripper) *Client {
 	// 提高超时时间，缓解偶发的首包慢/网络抖动
 	return &Client{
-		httpClient: &http.Client{Timeout: 20 * time.Second},
+		httpClient: &http.Client{Timeout: 20 * time.Second, Transport: rt},
 		UserAgent:  userAgent,
+		log:        logging.Discard(),
+	}
+}
+
+// SetLogger injects the logger used for request tracing.
+func (cli *Client) SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = logging.Discard()
 	}
+	cli.log = l
 }
 
 func (cli *Client) doJSON(method, url, openid string, reqt_body any, resp_body any, referrer string) error {
@@ -77,14 +98,20 @@ func (cli *Client) doJSON(method, url, openid string, reqt_body any, resp_body a
 		req.Header.Set("Referrer", referrer)
 	}
 	//发送请求
+	start := time.Now()
 	resp, err := cli.httpClient.Do(req)
+	elapsed := time.Since(start)
 	if err != nil {
+		cli.log.Debug("request failed", "method", method, "url", url, "err", err, "elapsed", elapsed)
+		metrics.HTTPDuration.Observe(elapsed.Seconds(), method, req.URL.Path, "error")
 		return err
 	}
 	defer resp.Body.Close()
+	cli.log.Debug("request", "method", method, "url", url, "status", resp.StatusCode, "elapsed", elapsed)
+	metrics.HTTPDuration.Observe(elapsed.Seconds(), method, req.URL.Path, strconv.Itoa(resp.StatusCode))
 	//检查响应码
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 	//获取响应体
 	dec := json.NewDecoder(resp.Body)
@@ -106,31 +133,68 @@ func (c *Client) SignIn(openID string, q SignInQuery) (map[string]interface{}, e
 	return out, err
 }
 
-func (c *Client) GetStudentName(openID string) (string, error) {
+// StudentProfile holds the fields returned by v2/students.
+type StudentProfile struct {
+	Name          string
+	StudentNumber string
+	Fields        map[string]interface{} // 全部 item_name -> item_value
+}
+
+// GetStudentProfile reads the student's profile; it doubles as the openid validity check.
+func (c *Client) GetStudentProfile(openID string) (*StudentProfile, error) {
 	var data [][]StudentField // 对应返回的二维数组结构
 
 	err := c.doJSON("GET",
-		"https://v18.teachermate.cn/wechat-api/v2/students",
+		studentsURL,
 		openID,
 		nil,
 		&data,
 		fmt.Sprintf("https://v18.teachermate.cn/wechat-pro/student/edit?openid=%s", openID),
 	)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	p := profileFromFields(data)
+	if p.Name == "" {
+		return nil, ErrNoProfile
+	}
+	return p, nil
+}
+
+// studentsURL returns the student's profile fields.
+const studentsURL = "https://v18.teachermate.cn/wechat-api/v2/students"
 
+// profileFromFields collects the profile from the grouped fields of a students response.
+func profileFromFields(data [][]StudentField) *StudentProfile {
 	// 遍历所有组的所有字段
+	p := &StudentProfile{Fields: map[string]interface{}{}}
 	for _, group := range data {
 		for _, field := range group {
-			if field.ItemName == "name" {
-				// 确保值是字符串类型
-				if name, ok := field.ItemValue.(string); ok && name != "" {
-					return name, nil
+			p.Fields[field.ItemName] = field.ItemValue
+			// 确保值是字符串类型
+			v, ok := field.ItemValue.(string)
+			if !ok || v == "" {
+				continue
+			}
+			switch field.ItemName {
+			case "name":
+				if p.Name == "" {
+					p.Name = v
+				}
+			case "student_number", "studentNumber", "number":
+				if p.StudentNumber == "" {
+					p.StudentNumber = v
 				}
 			}
 		}
 	}
+	return p
+}
 
-	return "", fmt.Errorf("can't find name")
+func (c *Client) GetStudentName(openID string) (string, error) {
+	p, err := c.GetStudentProfile(openID)
+	if err != nil {
+		return "", err
+	}
+	return p.Name, nil
 }
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// ControlRequest is the body of POST /control.
+type ControlRequest struct {
+	Command string `json:"command"`       // pause / resume / poll / mode / debug / openid / status
+	Arg     string `json:"arg,omitempty"` // mode: autoqr 后端名；debug: on|off（留空为切换）；openid: openid 或含 openid 的链接
+}
+
+// ControlResponse is the reply of POST /control.
+type ControlResponse struct {
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Result any    `json:"result,omitempty"`
+}
+
+// ControlFunc executes one command; the result is returned to the caller as JSON.
+type ControlFunc func(req ControlRequest) (any, error)
+
+// handleControl only accepts JSON POSTs: browsers cannot send those cross-origin without
+// a CORS preflight, which this server never answers, so other web pages cannot drive it.
+func (s *Server) handleControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.writeJSON(w, http.StatusMethodNotAllowed, ControlResponse{Error: "POST only"})
+		return
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/json" {
+		s.writeJSON(w, http.StatusUnsupportedMediaType, ControlResponse{Error: "Content-Type must be application/json"})
+		return
+	}
+	if s.opts.ControlToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.opts.ControlToken)) != 1 {
+		s.writeJSON(w, http.StatusUnauthorized, ControlResponse{Error: "bad token"})
+		return
+	}
+	var req ControlRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		s.writeJSON(w, http.StatusBadRequest, ControlResponse{Error: err.Error()})
+		return
+	}
+	res, err := s.opts.Control(req)
+	if err != nil {
+		s.log.Warn("control command rejected", "command", req.Command, "arg", req.Arg, "err", err)
+		s.writeJSON(w, http.StatusBadRequest, ControlResponse{Error: err.Error()})
+		return
+	}
+	s.log.Info("control command", "command", req.Command, "arg", req.Arg)
+	s.writeJSON(w, http.StatusOK, ControlResponse{OK: true, Result: res})
+}
+
+// Control sends one command to a running instance at addr (host:port).
+func Control(addr, token string, req ControlRequest) (*ControlResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequest(http.MethodPost, "http://"+addr+"/control", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var out ControlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	return &out, nil
+}
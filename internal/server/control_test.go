@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// controlRecorder is a ControlFunc that remembers the commands it received.
+type controlRecorder struct {
+	mu   sync.Mutex
+	reqs []ControlRequest
+}
+
+func (c *controlRecorder) control(req ControlRequest) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reqs = append(c.reqs, req)
+	if req.Command == "bogus" {
+		return nil, errBogus
+	}
+	return map[string]any{"paused": req.Command == "pause"}, nil
+}
+
+func (c *controlRecorder) received() []ControlRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ControlRequest(nil), c.reqs...)
+}
+
+var errBogus = errors.New("unknown command")
+
+func TestControlRequests(t *testing.T) {
+	rec := &controlRecorder{}
+	ts := newTestServer(t, Options{Control: rec.control, ControlToken: "t0ken"})
+
+	tests := []struct {
+		name   string
+		method string
+		ctype  string
+		auth   string
+		body   string
+		code   int
+	}{
+		{"missing token", "POST", "application/json", "", `{"command":"pause"}`, http.StatusUnauthorized},
+		{"wrong token", "POST", "application/json", "Bearer nope", `{"command":"pause"}`, http.StatusUnauthorized},
+		{"token without scheme", "POST", "application/json", "t0ken", `{"command":"pause"}`, http.StatusUnauthorized},
+		{"GET", "GET", "", "Bearer t0ken", "", http.StatusMethodNotAllowed},
+		{"form post", "POST", "application/x-www-form-urlencoded", "Bearer t0ken", "command=pause", http.StatusUnsupportedMediaType},
+		{"text post", "POST", "text/plain", "Bearer t0ken", `{"command":"pause"}`, http.StatusUnsupportedMediaType},
+		{"bad json", "POST", "application/json", "Bearer t0ken", `{"command":`, http.StatusBadRequest},
+		{"rejected command", "POST", "application/json", "Bearer t0ken", `{"command":"bogus"}`, http.StatusBadRequest},
+		{"ok", "POST", "application/json; charset=utf-8", "Bearer t0ken", `{"command":"pause"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+"/control", strings.NewReader(tt.body))
+			if tt.ctype != "" {
+				req.Header.Set("Content-Type", tt.ctype)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var out ControlResponse
+			if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.code || out.OK != (tt.code == http.StatusOK) {
+				t.Fatalf("status %d ok=%v error=%q, want %d", resp.StatusCode, out.OK, out.Error, tt.code)
+			}
+			if tt.code == http.StatusMethodNotAllowed && resp.Header.Get("Allow") != "POST" {
+				t.Fatalf("Allow = %q", resp.Header.Get("Allow"))
+			}
+		})
+	}
+
+	// 只有通过校验的请求到达控制函数
+	got := rec.received()
+	if len(got) != 2 || got[0].Command != "bogus" || got[1].Command != "pause" {
+		t.Fatalf("control handler received %+v", got)
+	}
+}
+
+func TestControlClient(t *testing.T) {
+	rec := &controlRecorder{}
+	ts := newTestServer(t, Options{Control: rec.control, ControlToken: "t0ken"})
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	resp, err := Control(addr, "t0ken", ControlRequest{Command: "mode", Arg: "manual"})
+	if err != nil || !resp.OK {
+		t.Fatalf("Control() = %+v, %v", resp, err)
+	}
+	if got := rec.received(); len(got) != 1 || got[0] != (ControlRequest{Command: "mode", Arg: "manual"}) {
+		t.Fatalf("received %+v", got)
+	}
+	if resp, err := Control(addr, "", ControlRequest{Command: "pause"}); err != nil || resp.OK || resp.Error == "" {
+		t.Fatalf("Control() without token = %+v, %v", resp, err)
+	}
+}
+
+func TestControlDisabledWithoutHandler(t *testing.T) {
+	ts := newTestServer(t, Options{})
+	resp, err := http.Post(ts.URL+"/control", "application/json", strings.NewReader(`{"command":"pause"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// Options configures the local status server.
+type Options struct {
+	Addr         string              // 监听地址，建议 127.0.0.1:port
+	Status       func() any          // /status 的内容，由编排器组装
+	Health       func() error        // 非 nil 错误时 /healthz 返回 503
+	Events       *events.Bus         // 事件来源：/history 与 /events(SSE)
+	HistorySize  int                 // 保留的最近事件条数
+	Redact       func(string) string // 输出前对 JSON 文本脱敏，nil 表示不处理
+	Control      ControlFunc         // 非 nil 时启用 POST /control
+	ControlToken string              // 非空时 /control 要求 Authorization: Bearer <token>
+	Logger       *slog.Logger
+}
+
+// Server serves /status, /history, /healthz, an SSE stream at /events, the optional
+// /control API and a small dashboard at /. Other packages may mount extra handlers via Handle.
+type Server struct {
+	opts  Options
+	log   *slog.Logger
+	mux   *http.ServeMux
+	srv   *http.Server
+	start time.Time
+
+	mu      sync.Mutex
+	history []events.Event
+	unsub   func()
+	done    chan struct{} // 关闭时通知 SSE 连接结束
+	wg      sync.WaitGroup
+}
+
+func New(opts Options) *Server {
+	if opts.HistorySize <= 0 {
+		opts.HistorySize = 200
+	}
+	if opts.Logger == nil {
+		opts.Logger = logging.Discard()
+	}
+	s := &Server{
+		opts:  opts,
+		log:   opts.Logger,
+		mux:   http.NewServeMux(),
+		start: time.Now(),
+		done:  make(chan struct{}),
+	}
+	s.mux.HandleFunc("/", s.handleIndex)
+	s.mux.HandleFunc("/status", s.handleStatus)
+	s.mux.HandleFunc("/history", s.handleHistory)
+	s.mux.HandleFunc("/healthz", s.handleHealth)
+	s.mux.HandleFunc("/events", s.handleEvents)
+	if opts.Control != nil {
+		s.mux.HandleFunc("/control", s.handleControl)
+	}
+	return s
+}
+
+// Handle mounts an extra handler on the server's mux.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+// Start listens on Addr and serves in the background.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", s.opts.Addr, err)
+	}
+	if s.opts.Events != nil {
+		ch, unsub := s.opts.Events.Subscribe(64)
+		s.unsub = unsub
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for ev := range ch {
+				s.record(ev)
+			}
+		}()
+	}
+	s.srv = &http.Server{Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Warn("status server stopped", "err", err)
+		}
+	}()
+	s.log.Info("status server listening", "addr", ln.Addr().String())
+	return nil
+}
+
+// Close ends SSE streams, shuts the HTTP server down and waits for its goroutines.
+func (s *Server) Close(ctx context.Context) error {
+	if s.srv == nil {
+		return nil
+	}
+	close(s.done)
+	if s.unsub != nil {
+		s.unsub()
+	}
+	err := s.srv.Shutdown(ctx)
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) record(ev events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = append(s.history, ev)
+	if n := len(s.history) - s.opts.HistorySize; n > 0 {
+		s.history = append([]events.Event(nil), s.history[n:]...)
+	}
+}
+
+// History returns the recorded events, oldest first.
+func (s *Server) History() []events.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]events.Event(nil), s.history...)
+}
+
+// marshal encodes v and applies the redaction to the JSON text.
+func (s *Server) marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.Redact != nil {
+		data = []byte(s.opts.Redact(string(data)))
+	}
+	return data, nil
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, code int, v any) {
+	data, err := s.marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(data)
+	w.Write([]byte("\n"))
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var st any = map[string]any{}
+	if s.opts.Status != nil {
+		st = s.opts.Status()
+	}
+	s.writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.History())
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{"status": "ok", "uptime": time.Since(s.start).Round(time.Second).String()}
+	code := http.StatusOK
+	if s.opts.Health != nil {
+		if err := s.opts.Health(); err != nil {
+			body["status"] = "degraded"
+			body["error"] = err.Error()
+			code = http.StatusServiceUnavailable
+		}
+	}
+	s.writeJSON(w, code, body)
+}
+
+// handleEvents streams bus events as Server-Sent Events until the client goes away.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || s.opts.Events == nil {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch, unsub := s.opts.Events.Subscribe(32)
+	defer unsub()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	// 定期发送注释行，防止代理/浏览器判定连接空闲
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := s.marshal(ev)
+			if err != nil {
+				continue
+			}
+			// 事件类型在 data.kind 中，浏览器端统一用 onmessage 处理
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
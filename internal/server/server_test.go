@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+)
+
+func newTestServer(t *testing.T, opts Options) *httptest.Server {
+	t.Helper()
+	s := New(opts)
+	ts := httptest.NewServer(s.mux)
+	t.Cleanup(func() {
+		close(s.done)
+		ts.Close()
+	})
+	return ts
+}
+
+func TestEventsStream(t *testing.T) {
+	bus := events.NewBus()
+	ts := newTestServer(t, Options{
+		Events: bus,
+		Redact: func(s string) string { return strings.ReplaceAll(s, "测试同学", "[name]") },
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q", ct)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Fatalf("cache control = %q", cc)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		t.Helper()
+		var lines []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read stream: %v", err)
+			}
+			line = strings.TrimRight(line, "\n")
+			if line == "" {
+				return strings.Join(lines, "\n")
+			}
+			lines = append(lines, line)
+		}
+	}
+	// 先收到连接注释，之后才订阅成功
+	if first := readEvent(); first != ": connected" {
+		t.Fatalf("first message = %q", first)
+	}
+
+	bus.Publish(events.QRResult, map[string]any{"name": "测试同学", "rank": 7})
+	bus.Publish(events.WSConnected, nil)
+	for _, want := range []string{events.QRResult, events.WSConnected} {
+		msg := readEvent()
+		data, ok := strings.CutPrefix(msg, "data: ")
+		if !ok {
+			t.Fatalf("message = %q, want a data line", msg)
+		}
+		var ev events.Event
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatalf("data %q: %v", data, err)
+		}
+		if ev.Kind != want {
+			t.Fatalf("kind = %q, want %q", ev.Kind, want)
+		}
+		if want == events.QRResult && ev.Fields["name"] != "[name]" {
+			t.Fatalf("event not redacted: %s", data)
+		}
+	}
+}
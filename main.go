@@ -2,31 +2,75 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/autoqr"
 	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/config"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
 	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/input"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/metrics"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/notify"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qr"
 	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qrws"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/redact"
 	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/requests"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/server"
 )
 
-// timestamped logging helpers for main
-func ts() string                      { return time.Now().Format("2006-01-02 15:04:05.000") }
-func logln(args ...any)               { fmt.Println(append([]any{"[" + ts() + "]"}, args...)...) }
-func logf(format string, args ...any) { fmt.Printf("[%s] ", ts()); fmt.Printf(format, args...) }
+// log is the orchestrator logger; replaced once config is loaded
+var log = slog.New(slog.NewTextHandler(os.Stderr, nil))
 
 func main() {
-	// 读取配置
-	cfg, err := config.Load()
+	// 子命令：replay <file> 离线回放 WS 录制
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:]))
+	}
+	// 子命令：ctl <command> 控制正在运行的实例
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(runCtl(os.Args[2:]))
+	}
+	// 子命令：config init [file] 生成带注释的配置模板
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:]))
+	}
+	unsafeLog := flag.Bool("unsafe-log", false, "不遮蔽日志/录制中的 openid、学号、姓名（仅用于排查）")
+	cfgPath := flag.String("config", "", "配置文件（.json/.yaml/.yml/.toml），默认依次查找 config.json、config.yaml、config.yml、config.toml；也可用环境变量 WZJ_CONFIG")
+	cfgFlags := config.BindFlags(flag.CommandLine)
+	flag.Parse()
+	redact.SetEnabled(!*unsafeLog)
+
+	// 读取配置：默认值 < 配置文件 < 环境变量 WZJ_* < 命令行
+	loader := &config.Loader{Path: configPath(*cfgPath), Env: os.Environ(), Flags: cfgFlags.Values(), Check: checkScanner}
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Error("your config.json is error", "err", err)
+		os.Exit(1)
+	}
+	// 初始化共享日志：debug=1 时默认级别为 debug，可按子系统单独覆盖
+	logs, err := logging.New(loggingOptions(cfg, *unsafeLog))
 	if err != nil {
-		logln("your config.json is error:", err)
+		log.Error("your log config is error", "err", err)
 		os.Exit(1)
 	}
-	// 配置调试级别：1 打印详细日志，否则仅必要日志
-	qrws.SetDebug(cfg.Debug == 1)
+	defer logs.Close()
+	log = logs.Logger("main")
+	autoqr.SetLogger(logs.Logger("autoqr"))
+	setQRRenderer(cfg)
+	// 生成的二维码图片与 AHK 脚本放在本进程独占的临时目录，退出时删除；顺带清理崩溃残留
+	if wd, err := autoqr.OpenWorkdir(cfg.AutoQRWorkdir); err != nil {
+		log.Warn("[AutoQR] 无法创建临时目录，改用系统临时目录", "root", cfg.AutoQRWorkdir, "err", err)
+	} else {
+		autoqr.SetWorkdir(wd)
+		defer wd.Close()
+	}
 
 	// 选择签到地点
 	fmt.Println("请选择签到地点:")
@@ -36,173 +80,269 @@ func main() {
 	var locChoice int
 	fmt.Print("请输入序号 (1-3): ")
 	fmt.Scanln(&locChoice)
+	// fileCfg 保留文件中的原始坐标，热加载时据此计算差异并重新套用所选地点
+	fileCfg := *cfg
+	applyLocation(cfg, locChoice)
 
-	switch locChoice {
-	case 1:
-		if cfg.Lat_W12 != 0 && cfg.Lon_W12 != 0 {
-			cfg.Lat = cfg.Lat_W12
-			cfg.Lon = cfg.Lon_W12
-			logf("已选择西十二楼: lat=%.6f, lon=%.6f\n", cfg.Lat, cfg.Lon)
-		} else {
-			logln("警告: 未配置西十二楼坐标 (lat_w12, lon_w12)，将使用默认配置")
-		}
-	case 2:
-		if cfg.Lat_S1 != 0 && cfg.Lon_S1 != 0 {
-			cfg.Lat = cfg.Lat_S1
-			cfg.Lon = cfg.Lon_S1
-			logf("已选择南一楼: lat=%.6f, lon=%.6f\n", cfg.Lat, cfg.Lon)
-		} else {
-			logln("警告: 未配置南一楼坐标 (lat_s1, lon_s1)，将使用默认配置")
-		}
-	default:
-		logln("使用默认配置坐标")
-	}
-
-	// 提取 openid
-	var openid string
-	for {
-		id, err := input.GetOpenid()
+	var transport http.RoundTripper
+	if cfg.HTTPCassette != "" {
+		rec, err := requests.NewRecorder(cfg.HTTPCassette, requests.CassetteMode(cfg.HTTPCassetteMode), nil)
 		if err != nil {
-			logln(err)
-			continue
+			log.Error("your http cassette is error", "err", err)
+			os.Exit(1)
 		}
-		openid = id
-		break
+		defer rec.Close()
+		if !*unsafeLog {
+			rec.SetRedactor(redact.String)
+			rec.SetProfileHook(registerProfile)
+		}
+		transport = rec
+		log.Info("[HTTP] cassette 已启用", "mode", cfg.HTTPCassetteMode, "file", cfg.HTTPCassette)
 	}
+	cli := requests.NewWithTransport(cfg.Ua, transport)
+	cli.SetLogger(logs.Logger("requests"))
 
-	cli := requests.New(cfg.Ua)
-	stuName, err := cli.GetStudentName(openid)
+	// 提取 openid：优先使用已保存且仍有效的凭据，失效时才重新输入
+	store := credentialStore(cfg)
+	openid, profile := acquireOpenid(cli, store)
+	log.Info("学生姓名", "name", profile.Name)
+	// 事件总线：编排器与 qrws 发布事件，通知等订阅方消费
+	bus := events.NewBus()
+	notifier, err := notify.NewDispatcher(notifyOptions(cfg), logs.Logger("notify"), redactFunc(*unsafeLog))
 	if err != nil {
-		logln("your openid is invalid", err)
+		log.Error("your notify config is error", "err", err)
 		os.Exit(1)
 	}
-	logln(stuName)
+	// stopNotify 在退出前发送完剩余通知
+	stopNotify := func() {}
+	if notifier.Len() > 0 {
+		evCh, unsubscribe := bus.Subscribe(64)
+		runDone := make(chan struct{})
+		go func() {
+			notifier.Run(context.Background(), evCh)
+			close(runDone)
+		}()
+		stopNotify = func() {
+			unsubscribe()
+			<-runDone
+			notifier.Wait(5 * time.Second)
+		}
+		log.Info("通知已启用", "sinks", notifier.Len())
+	}
+	defer stopNotify()
+	sess := newSession(cli, store, bus, openid, profile)
+	// 定期校验 openid，失效时进入 session expired 状态并等待新的 openid（不重启、不断开 WS）
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go sess.healthLoop(healthCtx, time.Duration(cfg.OpenIDCheckIntervalMS)*time.Millisecond)
 
 	// 启动预连接（仅握手与保活，不订阅）
-	warm := qrws.New()
+	var recorder *qrws.Recorder
+	if cfg.WSRecordFile != "" {
+		recorder, err = qrws.NewRecorder(cfg.WSRecordFile)
+		if err != nil {
+			log.Warn("无法开启 WS 录制", "err", err)
+		} else {
+			if !*unsafeLog {
+				recorder.SetRedactor(redact.String)
+			}
+			log.Info("[WS] 录制收发帧", "file", cfg.WSRecordFile)
+		}
+	}
+	discoveryFile := cfg.WSDiscoveryFile
+	if discoveryFile == "none" {
+		discoveryFile = ""
+	}
+	discovery, err := qrws.NewDiscovery(discoveryFile)
+	if err != nil {
+		log.Warn("无法打开 WS 未知消息记录文件，仅在内存计数", "err", err)
+		discovery, _ = qrws.NewDiscovery("")
+	}
+	if !*unsafeLog {
+		discovery.SetRedactor(redact.String)
+	}
+	warm := qrws.NewWithOptions(qrws.Options{
+		ReadTimeout:    time.Duration(cfg.WSReadTimeoutMS) * time.Millisecond,
+		WriteTimeout:   time.Duration(cfg.WSWriteTimeoutMS) * time.Millisecond,
+		PingInterval:   time.Duration(cfg.WSPingIntervalMS) * time.Millisecond,
+		MaxMessageSize: cfg.WSMaxMessageSize,
+		Recorder:       recorder,
+		Discovery:      discovery,
+		Logger:         logs.Logger("qrws"),
+		Events:         bus,
+		// 只把本人结果交给主循环，其他同学的结果不会占满 ResultCh
+		OwnResult: func(res qrws.StudentResult) bool { return isOwnResult(res, sess.Profile()) },
+	})
+	// 二维码由 qrws 只负责推送，显示与扫描在这里消费，互不阻塞
+	qrCtx, stopQR := context.WithCancel(context.Background())
+	defer stopQR()
+	renderCh, scanCh := make(chan string, 1), make(chan string, 1)
+	go dispatchQR(qrCtx, warm.QrURLCh, renderCh, scanCh)
+	go renderLoop(qrCtx, renderCh)
 	if err := warm.Start(); err == nil {
-		logln("[Preconnect] QR 通道握手已发起")
+		log.Info("[Preconnect] QR 通道握手已发起")
 	} else {
-		logln("[警告] 预连接失败:", err)
+		log.Warn("[Preconnect] 预连接失败", "err", err)
+	}
+
+	// 运行中的配置：热加载时整体替换，轮询每一轮读取最新值
+	var live atomic.Pointer[config.Config]
+	live.Store(cfg)
+
+	// 本地状态页/API（仅在配置 http_addr 时启用），/control 可在运行中暂停/切换模式
+	poll := &pollState{}
+	ctl := newController(logs, cfg.AutoQRMode)
+	ctl.checkMode = func(mode string) error {
+		c := *live.Load()
+		c.AutoQRMode = mode
+		return checkScanner(&c)
+	}
+	ctl.status = func() any { return buildStatus(sess, warm, poll, ctl) }
+	ctl.renew = sess.Renew
+	var statusSrv *server.Server
+	if cfg.HTTPAddr != "" {
+		statusSrv = server.New(server.Options{
+			Addr:         cfg.HTTPAddr,
+			Status:       ctl.status,
+			Health:       sessionHealth(sess),
+			Events:       bus,
+			Redact:       redactFunc(*unsafeLog),
+			Control:      ctl.Execute,
+			ControlToken: controlToken(cfg),
+			Logger:       logs.Logger("server"),
+		})
+		if cfg.MetricsPath != "none" {
+			statusSrv.Handle(cfg.MetricsPath, metrics.Handler())
+		}
+		if err := statusSrv.Start(); err != nil {
+			log.Warn("[HTTP] 状态页启动失败", "err", err)
+			statusSrv = nil
+		} else {
+			log.Info("[HTTP] 状态页已启动", "url", "http://"+cfg.HTTPAddr+"/")
+		}
 	}
 
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	go watchConfig(reloadCtx, loader, &fileCfg, &live, locChoice, logs, ctl)
+
 	// 轮询并处理签到
 	var lastAutoQRSignID int
+	// 当前二维码签到的扫描循环：收到本人结果或签到结束时停止
+	var scanSignID int
+	var resultSignID int // 已收到本人结果的签到，不再等待
+	stopScan := context.CancelFunc(func() {})
+	endScan := func(reason string) {
+		if scanSignID != 0 {
+			log.Info("[AutoQR] 停止扫描", "signId", scanSignID, "reason", reason)
+			stopScan()
+			scanSignID = 0
+		}
+	}
+	defer func() { endScan("exit") }()
+	var lastDetectedSignID int
+	var detectedAt time.Time     // 当前签到首次检测到的时间，用于结果延迟指标
+	var resultDeadline time.Time // 等待本人结果的截止时间，超时只记录一次
 	for {
+		if sess.Expired() {
+			sess.waitRenewed()
+		}
+		ctl.waitWhilePaused()
+		cfg := live.Load()
+		openid := sess.OpenID()
 		active, err := cli.ActiveSigns(openid)
+		poll.record(active, err)
+		metrics.Polls.Inc()
 		if err != nil {
-			logln(err)
-			os.Exit(1)
+			metrics.PollErrors.Inc(requests.ErrorType(err))
+			if requests.IsUnauthorized(err) {
+				sess.markExpired(err)
+				continue
+			}
+			// 临时错误（网络抖动等）不再直接退出，等待下一轮
+			log.Warn("查询活跃签到失败", "err", err)
+			ctl.sleep(time.Duration(cfg.Polling_interval) * time.Millisecond)
+			continue
+		}
+		if scanSignID != 0 && !hasSign(active, scanSignID) {
+			endScan("sign ended")
 		}
 		if len(active) == 0 {
-			time.Sleep(time.Duration(cfg.Polling_interval) * time.Millisecond)
-			logln("no active sign")
+			ctl.sleep(time.Duration(cfg.Polling_interval) * time.Millisecond)
+			log.Info("no active sign")
 			continue
 		}
 
 		a := active[0]
-		logln(a)
+		log.Info("检测到签到", "courseId", a.CourseID, "signId", a.SignID, "name", a.Name, "isGPS", a.IsGPS, "isQR", a.IsQR)
+		if a.SignID != lastDetectedSignID {
+			lastDetectedSignID = a.SignID
+			detectedAt = time.Now()
+			metrics.SignsDetected.Inc(signType(a))
+			bus.Publish(events.SignDetected, signFields(a, nil))
+		}
+
+		if a.IsQR == 1 && a.SignID == resultSignID {
+			log.Debug("[QR] 本签到已收到本人结果，等待签到结束", "signId", a.SignID)
+			ctl.sleep(time.Duration(cfg.Polling_interval) * time.Millisecond)
+			continue
+		}
 
 		// 延迟策略优化：根据签到类型使用不同的延迟配置
 		if a.IsQR == 1 {
-			if cfg.Start_delay_qr > 0 {
-				logf("检测到二维码签到，等待 %d 毫秒...\n", cfg.Start_delay_qr)
+			// 二维码签到每轮都会回到这里，只在首次检测到时延迟
+			if cfg.Start_delay_qr > 0 && a.SignID != lastAutoQRSignID {
+				log.Info("检测到二维码签到，等待中", "delay_ms", cfg.Start_delay_qr)
 				time.Sleep(time.Duration(cfg.Start_delay_qr) * time.Millisecond)
 			}
 		} else if a.IsGPS == 1 {
 			if cfg.Start_delay_gps > 0 {
-				logf("检测到定位签到，等待 %d 毫秒...\n", cfg.Start_delay_gps)
+				log.Info("检测到定位签到，等待中", "delay_ms", cfg.Start_delay_gps)
 				time.Sleep(time.Duration(cfg.Start_delay_gps) * time.Millisecond)
 			}
 		} else {
 			if cfg.Start_delay > 0 {
-				logf("检测到普通签到，等待 %d 毫秒...\n", cfg.Start_delay)
+				log.Info("检测到普通签到，等待中", "delay_ms", cfg.Start_delay)
 				time.Sleep(time.Duration(cfg.Start_delay) * time.Millisecond)
 			}
 		}
 
 		// 分支处理：二维码 vs 定位 vs 普通
 		if a.IsQR == 1 {
-			// 订阅 QR 通道以接收二维码与结果
+			// 订阅 QR 通道以接收二维码与结果（重复调用无副作用）
 			warm.Attach(a.CourseID, a.SignID)
-			// 这里的 Attach 可能只是登记了待订阅（若 connect 尚未完成），因此提示更中性
-			logf("[QR] 已登记订阅目标 /attendance/%d/%d/qr，等待连接/二维码...\n", a.CourseID, a.SignID)
-
-			// 模式控制：manual 仅等待扫码；autohotkey 自动反复截图识别
-			if cfg.AutoQRMode == "autohotkey" {
-				if lastAutoQRSignID != a.SignID {
-					lastAutoQRSignID = a.SignID
-					courseID := a.CourseID
-					signID := a.SignID
-					// 控制扫描协程的结束（仅在 QR 更新时触发扫描）
-					autoDone := make(chan struct{})
-					go func() {
-						logf("[AutoQR] 等待二维码链接以触发 PC 微信截图识别 courseId=%d signId=%d\n", courseID, signID)
-						var lastQR string
-						var lastPNG string
-						// 内部函数：对当前 QR 执行一次截图识别
-						doScan := func() {
-							if lastQR == "" {
-								return
-							}
-							// 初次或 QR 更新时生成新 PNG
-							if lastPNG == "" {
-								p, err := autoqr.GenerateQRPng(lastQR, 320)
-								if err != nil {
-									logf("[AutoQR] 生成二维码 PNG 失败: %v\n", err)
-									return
-								}
-								lastPNG = p
-								logf("[AutoQR] 已生成二维码图片: %s\n", lastPNG)
-							}
-							if err := autoqr.LaunchWeChatScreenshot(lastPNG, cfg.AutoQRX, cfg.AutoQRY, cfg.AutoQRSize, cfg.AutoQRRecognizeX, cfg.AutoQRRecognizeY); err != nil {
-								logf("[AutoQR] 调用 AutoHotkey 失败: %v\n", err)
-								logln("[AutoQR] 提示: 请安装 AutoHotkey(v1) 并设置环境变量 AUTOHOTKEY_EXE，或手动按 Alt+A 截图框选生成的二维码图片以识别")
-							} else {
-								logln("[AutoQR] 已触发 Alt+A 并框选二维码，等待 WeChat 识别与 WS 回推(type=3)")
-							}
-						}
-
-						// 主循环：仅在接收到新 QR 时进行扫描
-						for {
-							select {
-							case qrURL := <-warm.QrURLCh:
-								// 二维码更新：重置 PNG 并立即扫描
-								if qrURL != lastQR {
-									lastQR = qrURL
-									if lastPNG != "" {
-										// 尝试删除旧 PNG（忽略错误）
-										_ = os.Remove(lastPNG)
-										lastPNG = ""
-									}
-								}
-								doScan()
-							case <-autoDone:
-								if lastPNG != "" {
-									_ = os.Remove(lastPNG)
-								}
-								return
-							}
-						}
-					}()
-
-					// 在等待结果后关闭自动重扫
-					defer close(autoDone)
+
+			// 二维码交给 autoqr_mode 选择的扫描后端（manual/autohotkey/exec），每个签到启动一次
+			if lastAutoQRSignID != a.SignID {
+				// 这里的 Attach 可能只是登记了待订阅（若 connect 尚未完成），因此提示更中性
+				log.Info("[QR] 已登记订阅目标，等待连接/二维码...", "subscription", fmt.Sprintf("/attendance/%d/%d/qr", a.CourseID, a.SignID))
+				lastAutoQRSignID = a.SignID
+				resultDeadline = time.Now().Add(2 * time.Minute)
+				endScan("new sign")
+				var scanCtx context.Context
+				scanCtx, stopScan = context.WithCancel(context.Background())
+				scanSignID = a.SignID
+				select { // 丢弃上一个签到遗留的二维码
+				case <-scanCh:
+				default:
 				}
-			} else {
-				logln("[QR] 手动模式：不会触发 AutoHotkey 自动截图，请使用手机或 PC 微信自行识别二维码")
+				go scanLoop(scanCtx, scanCh, ctl, &live, bus, a.CourseID, a.SignID)
 			}
 
-			// 等待最多 2 分钟
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-			defer cancel()
-			select {
-			case res := <-warm.ResultCh:
-				logf("[Result] 学生: %s(%s) rank=%d id=%d\n", res.Name, res.StudentNumber, res.Rank, res.ID)
-			case <-ctx.Done():
-				logln("[Result] 等待结果超时，仍保持 WS 保活，可继续观察")
+			// 等待本人结果最多一个轮询间隔（强制轮询时提前返回），随后照常轮询，
+			// 签到结束、暂停、openid 失效都能及时处理
+			res, ok := waitOwnResult(warm.ResultCh, ctl.woken(), time.Duration(cfg.Polling_interval)*time.Millisecond)
+			if ok {
+				log.Info("[Result] 学生签到结果", "name", res.Name, "number", res.StudentNumber, "rank", res.Rank, "id", res.ID)
+				endScan("result")
+				resultSignID = a.SignID
+				recordOutcome(a, "0", detectedAt)
+				bus.Publish(events.QRResult, signFields(a, map[string]any{"name": res.Name, "studentNumber": res.StudentNumber, "rank": res.Rank}))
+			} else if !resultDeadline.IsZero() && time.Now().After(resultDeadline) {
+				log.Warn("[Result] 等待结果超时，仍保持 WS 保活，可继续观察")
+				recordOutcome(a, "timeout", detectedAt)
+				resultDeadline = time.Time{}
 			}
-			// 循环继续，可继续监听或再次检查活动
 			continue
 		}
 
@@ -211,18 +351,26 @@ func main() {
 			lon, lat := cfg.Lon, cfg.Lat
 			var lonPtr, latPtr *float64
 			if lon == 0 && lat == 0 {
-				logln("[GPS] 未配置坐标，将尝试无坐标签到")
+				log.Info("[GPS] 未配置坐标，将尝试无坐标签到")
 				lonPtr, latPtr = nil, nil
 			} else {
-				logf("[GPS] 使用坐标 lon=%.6f lat=%.6f\n", lon, lat)
+				log.Info("[GPS] 使用坐标", "lon", lon, "lat", lat)
 				lonPtr, latPtr = &lon, &lat
 			}
 			resp, err := cli.SignIn(openid, requests.SignInQuery{CourseID: a.CourseID, SignID: a.SignID, Lon: lonPtr, Lat: latPtr})
 			if err != nil {
-				logln("[GPS] 签到失败:", err)
+				if requests.IsUnauthorized(err) {
+					// openid 过期：等待续期后重新检测并签到
+					sess.markExpired(err)
+					continue
+				}
+				log.Error("[GPS] 签到失败", "err", err)
+				recordOutcome(a, "error", detectedAt)
+				bus.Publish(events.SignFailed, signFields(a, map[string]any{"error": err.Error()}))
+				stopNotify()
 				os.Exit(1)
 			}
-			
+
 			var errorCode float64
 			if val, ok := resp["errorCode"]; ok {
 				if v, ok := val.(float64); ok {
@@ -230,12 +378,13 @@ func main() {
 				}
 			}
 
+			recordOutcome(a, strconv.FormatFloat(errorCode, 'f', -1, 64), detectedAt)
 			if errorCode == 0 {
-				logln("[GPS] 签到成功")
-				logln("[GPS] 响应内容:", resp)
+				log.Info("[GPS] 签到成功", "resp", resp)
+				bus.Publish(events.SignSucceeded, signFields(a, nil))
 			} else {
-				logf("[GPS] 签到返回错误码: %.0f\n", errorCode)
-				logln("[GPS] 响应内容:", resp)
+				log.Warn("[GPS] 签到返回错误码", "errorCode", errorCode, "resp", resp)
+				bus.Publish(events.SignFailed, signFields(a, map[string]any{"errorCode": errorCode}))
 			}
 			// GPS/普通签到一次即结束
 			break
@@ -244,7 +393,14 @@ func main() {
 		// 普通签到（不带经纬度）
 		resp, err := cli.SignIn(openid, requests.SignInQuery{CourseID: a.CourseID, SignID: a.SignID})
 		if err != nil {
-			logln("[Sign] 签到失败:", err)
+			if requests.IsUnauthorized(err) {
+				sess.markExpired(err)
+				continue
+			}
+			log.Error("[Sign] 签到失败", "err", err)
+			recordOutcome(a, "error", detectedAt)
+			bus.Publish(events.SignFailed, signFields(a, map[string]any{"error": err.Error()}))
+			stopNotify()
 			os.Exit(1)
 		}
 
@@ -255,16 +411,202 @@ func main() {
 			}
 		}
 
+		recordOutcome(a, strconv.FormatFloat(errorCode, 'f', -1, 64), detectedAt)
 		if errorCode == 0 {
-			logln("[Sign] 签到成功")
-			logln("[Sign] 响应内容:", resp)
+			log.Info("[Sign] 签到成功", "resp", resp)
+			bus.Publish(events.SignSucceeded, signFields(a, nil))
 		} else {
-			logf("[Sign] 签到返回错误码: %.0f\n", errorCode)
-			logln("[Sign] 响应内容:", resp)
+			log.Warn("[Sign] 签到返回错误码", "errorCode", errorCode, "resp", resp)
+			bus.Publish(events.SignFailed, signFields(a, map[string]any{"errorCode": errorCode}))
 		}
 		break
 	}
 
+	// 礼貌断开 WS（/meta/disconnect）并等待后台协程退出
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), 5*time.Second)
+	if statusSrv != nil {
+		if err := statusSrv.Close(closeCtx); err != nil {
+			log.Warn("[HTTP] 关闭状态页未完成", "err", err)
+		}
+	}
+	if err := warm.Close(closeCtx); err != nil {
+		log.Warn("[WS] 关闭连接未完成", "err", err)
+	}
+	cancelClose()
+	if err := recorder.Close(); err != nil {
+		log.Warn("[WS] 关闭录制文件失败", "err", err)
+	}
+	if err := discovery.Close(); err != nil {
+		log.Warn("[WS] 关闭未知消息记录文件失败", "err", err)
+	}
+
 	fmt.Println("按回车键退出...")
-	fmt.Scanln()
+	// openid 输入可能已启动共享的标准输入读取协程，退出等待也经由它
+	<-input.Lines()
+}
+
+// runReplay feeds a recorded WS session back through qrws offline.
+func runReplay(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("usage: wzj-assistant-autoCkeckin replay <ws_record_file.jsonl>")
+		return 2
+	}
+	logs, err := logging.New(logging.Options{Level: "debug", Redact: redact.String})
+	if err != nil {
+		return 1
+	}
+	log = logs.Logger("main")
+	c, n, err := qrws.ReplayFile(args[0], qrws.Options{Logger: logs.Logger("qrws")})
+	if err != nil {
+		log.Error("[Replay] 回放失败", "err", err)
+		return 1
+	}
+	log.Info("[Replay] 回放完成", "frames", n)
+	select {
+	case url := <-c.QrURLCh:
+		log.Info("[Replay] 最后一个二维码", "url", url)
+		qr.Print(url)
+	default:
+	}
+	select {
+	case res := <-c.ResultCh:
+		log.Info("[Replay] 学生结果", "name", res.Name, "number", res.StudentNumber, "rank", res.Rank, "id", res.ID)
+	default:
+		log.Info("[Replay] 录制中没有学生结果(type=3)")
+	}
+	for _, u := range c.UnknownMessages() {
+		log.Info("[Replay] 未识别的消息", "reason", u.Reason, "channel", u.Channel, "type", u.Type, "keys", u.Keys, "count", u.Count)
+	}
+	return 0
+}
+
+// runConfig handles "config init [--force] [file]".
+func runConfig(args []string) int {
+	fs := flag.NewFlagSet("config init", flag.ContinueOnError)
+	force := fs.Bool("force", false, "覆盖已存在的文件")
+	usage := "usage: wzj-assistant-autoCkeckin config init [--force] [config.yaml|config.toml]"
+	if len(args) == 0 || args[0] != "init" {
+		fmt.Println(usage)
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 1 {
+		fmt.Println(usage)
+		return 2
+	}
+	path := "config.yaml"
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+	data, err := config.Template(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config init:", err)
+		return 1
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config init:", err)
+		return 1
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		fmt.Fprintln(os.Stderr, "config init:", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "config init:", err)
+		return 1
+	}
+	fmt.Println("已生成配置模板:", path)
+	return 0
+}
+
+// signType is qr, gps or normal, in the same precedence the poll loop uses.
+func signType(a requests.ActiveSign) string {
+	if a.IsQR == 1 {
+		return "qr"
+	} else if a.IsGPS == 1 {
+		return "gps"
+	}
+	return "normal"
+}
+
+// recordOutcome updates sign-in metrics; code is the errorCode, "error" or "timeout".
+func recordOutcome(a requests.ActiveSign, code string, detectedAt time.Time) {
+	typ := signType(a)
+	metrics.SignInResults.Inc(typ, code)
+	if code != "timeout" && !detectedAt.IsZero() {
+		metrics.SignLatency.Observe(time.Since(detectedAt).Seconds(), typ)
+	}
+}
+
+// signFields describes a sign for events; extra fields are merged in.
+func signFields(a requests.ActiveSign, extra map[string]any) map[string]any {
+	f := map[string]any{"courseId": a.CourseID, "signId": a.SignID, "name": a.Name, "type": signType(a)}
+	for k, v := range extra {
+		f[k] = v
+	}
+	return f
+}
+
+// redactFunc returns the redaction applied to outputs, or nil with --unsafe-log.
+func redactFunc(unsafeLog bool) func(string) string {
+	if unsafeLog {
+		return nil
+	}
+	return redact.String
+}
+
+// notifyOptions maps the notify entries of the config to sink options.
+func notifyOptions(cfg *config.Config) []notify.SinkOptions {
+	out := make([]notify.SinkOptions, 0, len(cfg.Notify))
+	for _, n := range cfg.Notify {
+		out = append(out, notify.SinkOptions{
+			Type:     n.Type,
+			Events:   n.Events,
+			Title:    n.Title,
+			Template: n.Template,
+			URL:      n.URL,
+			Headers:  n.Headers,
+			SMTPAddr: n.SMTPAddr,
+			Username: n.Username,
+			Password: n.Password,
+			From:     n.From,
+			To:       n.To,
+			Command:  n.Command,
+		})
+	}
+	return out
+}
+
+// loggingOptions maps config fields to the shared logger; debug=1 keeps its old meaning.
+// 除非 --unsafe-log，全部输出都经过 redact 遮蔽。
+// configPath resolves the config file: --config, then WZJ_CONFIG, then config.FindPath.
+func configPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if p := os.Getenv("WZJ_CONFIG"); p != "" {
+		return p
+	}
+	return config.FindPath()
+}
+
+func loggingOptions(cfg *config.Config, unsafeLog bool) logging.Options {
+	level := cfg.LogLevel
+	if cfg.Debug == 1 {
+		level = "debug"
+	}
+	return logging.Options{
+		Redact:     redactFunc(unsafeLog),
+		Level:      level,
+		Levels:     cfg.LogLevels,
+		Format:     cfg.LogFormat,
+		File:       cfg.LogFile,
+		MaxSizeMB:  cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
+	}
 }
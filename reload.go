@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/config"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+)
+
+// applyLocation sets lat/lon from the location chosen at startup (1 西十二楼, 2 南一楼).
+func applyLocation(cfg *config.Config, choice int) {
+	switch choice {
+	case 1:
+		if cfg.Lat_W12 != 0 && cfg.Lon_W12 != 0 {
+			cfg.Lat = cfg.Lat_W12
+			cfg.Lon = cfg.Lon_W12
+			log.Info("已选择西十二楼", "lat", cfg.Lat, "lon", cfg.Lon)
+		} else {
+			log.Warn("未配置西十二楼坐标 (lat_w12, lon_w12)，将使用默认配置")
+		}
+	case 2:
+		if cfg.Lat_S1 != 0 && cfg.Lon_S1 != 0 {
+			cfg.Lat = cfg.Lat_S1
+			cfg.Lon = cfg.Lon_S1
+			log.Info("已选择南一楼", "lat", cfg.Lat, "lon", cfg.Lon)
+		} else {
+			log.Warn("未配置南一楼坐标 (lat_s1, lon_s1)，将使用默认配置")
+		}
+	default:
+		log.Info("使用默认配置坐标", "lat", cfg.Lat, "lon", cfg.Lon)
+	}
+}
+
+// watchConfig reloads the config file when it changes, reapplying the env and flag
+// layers. Reloadable fields are copied onto a new config that replaces live in one
+// step; the rest is logged as needing a restart. An invalid file is rejected and the
+// running config stays untouched.
+func watchConfig(ctx context.Context, loader *config.Loader, fileCfg *config.Config, live *atomic.Pointer[config.Config], locChoice int, logs *logging.Manager, ctl *controller) {
+	w := &config.Watcher{
+		Path:     loader.Path,
+		Load:     loader.Load,
+		Interval: time.Duration(fileCfg.ConfigWatchIntervalMS) * time.Millisecond,
+		OnError: func(err error) {
+			log.Warn("[Config] 配置文件有误，已忽略本次修改", "err", err)
+		},
+		OnChange: func(old, next *config.Config) {
+			changes := config.Diff(old, next)
+			cur := *live.Load()
+			applied, skipped := config.ApplyReloadable(&cur, next, changes)
+			for _, ch := range skipped {
+				log.Warn("[Config] 该项需重启后生效", "change", ch.String())
+			}
+			if len(applied) == 0 {
+				return
+			}
+			var locationChanged, levelsChanged, modeChanged bool
+			for _, ch := range applied {
+				log.Info("[Config] 已应用", "change", ch.String())
+				switch {
+				case strings.HasPrefix(ch.Field, "lat") || strings.HasPrefix(ch.Field, "lon"):
+					locationChanged = true
+				case ch.Field == "debug" || strings.HasPrefix(ch.Field, "log_level"):
+					levelsChanged = true
+				case ch.Field == "autoqr_mode":
+					modeChanged = true
+				}
+			}
+			if locationChanged {
+				applyLocation(&cur, locChoice)
+			}
+			live.Store(&cur)
+			if levelsChanged {
+				applyLogLevels(logs, ctl, old, next)
+			}
+			if modeChanged {
+				ctl.setMode(next.AutoQRMode)
+			}
+			setQRRenderer(&cur)
+		},
+	}
+	w.Run(ctx, fileCfg)
+}
+
+// applyLogLevels updates the default and per-subsystem levels after a reload.
+func applyLogLevels(logs *logging.Manager, ctl *controller, old, next *config.Config) {
+	opts := loggingOptions(next, false)
+	def, _ := logging.ParseLevel(opts.Level)
+	logs.SetLevel("", def)
+	ctl.setBaseLevel(def)
+	for sub := range old.LogLevels {
+		if _, ok := next.LogLevels[sub]; !ok {
+			logs.ResetLevel(sub)
+		}
+	}
+	for sub, s := range next.LogLevels {
+		lvl, _ := logging.ParseLevel(s)
+		logs.SetLevel(sub, lvl)
+	}
+}
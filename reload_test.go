@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/config"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/logging"
+)
+
+// syncBuffer is a bytes.Buffer safe for the logger and the test to share.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestReloadChangesRunningSubsystemLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(body string, n int) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+		// 保证 mtime 一定变化
+		mod := time.Now().Add(time.Duration(n) * time.Second)
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"config_watch_interval_ms": 20}`, 0)
+
+	loader := &config.Loader{Path: path}
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out syncBuffer
+	logs, err := logging.NewWithWriter(loggingOptions(cfg, true), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 与启动时一样，子系统 logger 在重新加载之前就已创建
+	sub := logs.Logger("qrws")
+	prev := log
+	log = logs.Logger("main")
+	t.Cleanup(func() { log = prev })
+	ctl := newController(logs, cfg.AutoQRMode)
+	var live atomic.Pointer[config.Config]
+	live.Store(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchConfig(ctx, loader, cfg, &live, 0, logs, ctl)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	logUntil := func(want bool, msg string) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for {
+			sub.Debug(msg)
+			if strings.Contains(out.String(), msg) == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("debug output of %q present = %v, want %v; log:\n%s", msg, !want, want, out.String())
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	// Watcher 启动时先记录文件状态，等它开始轮询后再修改
+	time.Sleep(100 * time.Millisecond)
+	sub.Debug("initial")
+	if strings.Contains(out.String(), "initial") {
+		t.Fatal("debug logged before any override")
+	}
+
+	// 新增 log_levels 条目：已存在的 logger 立即输出 debug
+	write(`{"config_watch_interval_ms": 20, "log_levels": {"qrws": "debug"}}`, 1)
+	logUntil(true, "after-add")
+
+	// 删除条目：恢复为默认级别（info）
+	write(`{"config_watch_interval_ms": 20}`, 2)
+	deadline := time.Now().Add(3 * time.Second)
+	for logs.Level("qrws") != logs.Level("") {
+		if time.Now().After(deadline) {
+			t.Fatalf("qrws level = %v after removing the override, want default %v", logs.Level("qrws"), logs.Level(""))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	sub.Debug("after-remove")
+	if strings.Contains(out.String(), "after-remove") {
+		t.Fatal("removed override still logs debug")
+	}
+
+	// 之后修改默认级别，该子系统随之变化
+	write(`{"config_watch_interval_ms": 20, "log_level": "debug"}`, 3)
+	logUntil(true, "after-default")
+}
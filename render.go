@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qr"
+)
+
+// dispatchQR fans the QR URLs emitted by the WS client out to the renderer and the
+// scan loop. Both sides keep only the newest URL, so a slow terminal or scanner never
+// backs up into the WS read loop.
+func dispatchQR(ctx context.Context, in <-chan string, render, scan chan string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case url := <-in:
+			offerLatest(render, url)
+			offerLatest(scan, url)
+		}
+	}
+}
+
+// renderLoop shows every refreshed QR code with the configured qr_outputs.
+func renderLoop(ctx context.Context, urls <-chan string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case url := <-urls:
+			qr.Print(url)
+		}
+	}
+}
+
+// offerLatest puts v into a 1-slot channel, replacing a value nobody has taken yet.
+func offerLatest(ch chan string, v string) {
+	for {
+		select {
+		case ch <- v:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
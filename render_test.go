@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qr"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qrws"
+)
+
+// slowTerminal is a terminal that takes delay per write and remembers the URLs shown.
+// With a tiny Width the renderer prints only the link, so every write names its URL.
+type slowTerminal struct {
+	delay time.Duration
+	mu    sync.Mutex
+	urls  []string
+}
+
+func (w *slowTerminal) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	line := strings.TrimSpace(string(p))
+	w.mu.Lock()
+	w.urls = append(w.urls, line[strings.LastIndex(line, " ")+1:])
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+func (w *slowTerminal) shown() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.urls...)
+}
+
+func qrFrame(i int) string {
+	return fmt.Sprintf(`{"dir":"in","frame":[{"channel":"/attendance/1/2/qr","data":{"type":1,"qrUrl":"https://www.teachermate.com.cn/qr?t=%d"}}]}`, i)
+}
+
+// startRenderPipeline wires a WS client to dispatchQR/renderLoop with a slow terminal.
+func startRenderPipeline(t testing.TB, delay time.Duration) (*qrws.Client, *slowTerminal, chan string) {
+	term := &slowTerminal{delay: delay}
+	qr.SetDefault(&qr.Renderer{Terminal: &qr.Options{Writer: term, Width: 10}})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		qr.SetDefault(&qr.Renderer{Terminal: &qr.Options{}})
+	})
+	c := qrws.NewWithOptions(qrws.Options{})
+	renderCh, scanCh := make(chan string, 1), make(chan string, 1)
+	go dispatchQR(ctx, c.QrURLCh, renderCh, scanCh)
+	go renderLoop(ctx, renderCh)
+	return c, term, scanCh
+}
+
+func TestSlowRendererDoesNotBlockReadLoop(t *testing.T) {
+	const frames = 50
+	const delay = 100 * time.Millisecond
+	c, term, scanCh := startRenderPipeline(t, delay)
+
+	// 渲染一次 100ms，若在读循环里同步渲染，50 帧至少需要 5s
+	var maxFrame time.Duration
+	start := time.Now()
+	for i := 1; i <= frames; i++ {
+		t0 := time.Now()
+		if _, err := c.Replay(strings.NewReader(qrFrame(i))); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(t0); d > maxFrame {
+			maxFrame = d
+		}
+	}
+	total := time.Since(start)
+	if total > frames*delay/5 {
+		t.Fatalf("handling %d frames took %v (slowest %v); the read loop waited for the renderer", frames, total, maxFrame)
+	}
+
+	latest := "https://www.teachermate.com.cn/qr?t=50"
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		shown := term.shown()
+		if n := len(shown); n > 0 && shown[n-1] == latest {
+			// 慢渲染期间的中间二维码被丢弃：每次渲染结束时只取当时最新的一个
+			if n > int(total/delay)+2 {
+				t.Fatalf("rendered %d codes %v, want only the latest ones", n, shown)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("latest code never rendered, shown %v", term.shown())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case url := <-scanCh:
+		if url != latest {
+			t.Fatalf("scan channel holds %q, want %q", url, latest)
+		}
+	default:
+		t.Fatal("scan channel is empty")
+	}
+}
+
+func BenchmarkQRFrameWithSlowRenderer(b *testing.B) {
+	c, _, _ := startRenderPipeline(b, 50*time.Millisecond)
+	frame := qrFrame(1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Replay(strings.NewReader(frame)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
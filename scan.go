@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/autoqr"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/config"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/metrics"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qr"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qrws"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/requests"
+)
+
+// scannerOptions maps the autoqr_* settings to scanner options.
+func scannerOptions(cfg *config.Config) autoqr.Options {
+	return autoqr.Options{
+		PNGSize:    cfg.AutoQRSize,
+		X:          cfg.AutoQRX,
+		Y:          cfg.AutoQRY,
+		RecognizeX: cfg.AutoQRRecognizeX,
+		RecognizeY: cfg.AutoQRRecognizeY,
+		Command:    cfg.AutoQRCommand,
+		AHKVersion: cfg.AutoQRAHKVersion,
+		Timeout:    time.Duration(cfg.AutoQRTimeoutMS) * time.Millisecond,
+	}
+}
+
+// qrRenderer builds the QR output targets from the qr_* settings.
+func qrRenderer(cfg *config.Config) (*qr.Renderer, error) {
+	term := qr.Options{Level: cfg.QRLevel, Mode: cfg.QRMode, Invert: cfg.QRInvert, QuietZone: cfg.QRQuietZone}
+	return qr.NewRenderer(cfg.QROutputs, term, cfg.QRPNGSize, cfg.QRLevel)
+}
+
+// setQRRenderer installs the renderer used for refreshed QR codes; a broken config
+// keeps the previous one.
+func setQRRenderer(cfg *config.Config) {
+	r, err := qrRenderer(cfg)
+	if err != nil {
+		log.Warn("[QR] 二维码输出配置无效", "err", err)
+		return
+	}
+	qr.SetDefault(r)
+}
+
+// checkScanner is the Loader.Check hook: autoqr_mode must name a usable backend.
+func checkScanner(cfg *config.Config) error {
+	s, err := autoqr.New(cfg.AutoQRMode, scannerOptions(cfg))
+	if err != nil {
+		return err
+	}
+	return s.Close()
+}
+
+// 同一二维码在可重试失败后的重试次数与间隔；新二维码到达时重新计数
+const (
+	scanRetries    = 2
+	scanRetryDelay = time.Second
+)
+
+// rescanSchedule places rescans on a fixed grid base + n*interval from the latest QR URL,
+// so slow scanner runs never shift later attempts; slots that already passed are skipped.
+type rescanSchedule struct {
+	base time.Time
+	slot int
+}
+
+func (r *rescanSchedule) reset(now time.Time) {
+	r.base, r.slot = now, 0
+}
+
+// next returns the first grid slot after now.
+func (r *rescanSchedule) next(now time.Time, interval time.Duration) time.Time {
+	r.slot++
+	if t := r.base.Add(time.Duration(r.slot) * interval); t.After(now) {
+		return t
+	}
+	r.slot = int(now.Sub(r.base)/interval) + 1
+	return r.base.Add(time.Duration(r.slot) * interval)
+}
+
+// scanLoop hands every QR URL of one sign to the scanner selected by autoqr_mode until
+// ctx is done (our type=3 result arrived or the sign ended). After a triggered scan the
+// latest URL is rescanned every autoqr_interval_ms, up to autoqr_max_attempts runs per sign.
+// The scanner is rebuilt when the mode (ctl / hot reload) or its options change.
+// Failures are published as autoqr_failed; retryable ones are retried on the same URL.
+func scanLoop(ctx context.Context, qrCh <-chan string, ctl *controller, live *atomic.Pointer[config.Config], bus *events.Bus, courseID, signID int) {
+	log.Info("[AutoQR] 等待二维码链接", "courseId", courseID, "signId", signID, "mode", ctl.Mode())
+	var scanner autoqr.Scanner
+	var opts autoqr.Options
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer func() {
+		timer.Stop()
+		if scanner != nil {
+			scanner.Close()
+		}
+	}()
+	var qrURL string
+	var failures, attempts int
+	var sched rescanSchedule
+	var wake <-chan time.Time // nil 表示没有待执行的重扫/重试
+	schedule := func(at time.Time) {
+		timer.Reset(time.Until(at))
+		wake = timer.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case qrURL = <-qrCh:
+			failures = 0
+			sched.reset(time.Now())
+		case <-wake:
+			log.Debug("[AutoQR] 重新扫描", "attempt", attempts+1, "failures", failures)
+		}
+		timer.Stop()
+		wake = nil
+		cfg := live.Load()
+		if cfg.AutoQRMaxAttempts > 0 && attempts >= cfg.AutoQRMaxAttempts {
+			if attempts == cfg.AutoQRMaxAttempts {
+				attempts++ // 只提示一次
+				log.Warn("[AutoQR] 已达到最大扫描次数，停止自动扫描；请手动扫描终端二维码", "max", cfg.AutoQRMaxAttempts, "signId", signID)
+			}
+			continue
+		}
+		mode, next := ctl.Mode(), scannerOptions(cfg)
+		if scanner == nil || scanner.Name() != mode || !reflect.DeepEqual(opts, next) {
+			if scanner != nil {
+				scanner.Close()
+			}
+			s, err := autoqr.New(mode, next)
+			if err != nil {
+				log.Warn("[AutoQR] 无法创建扫描后端", "mode", mode, "err", err)
+				scanner = nil
+				continue
+			}
+			scanner, opts = s, next
+		}
+		attempts++
+		interval := time.Duration(cfg.AutoQRIntervalMS) * time.Millisecond
+		res, err := scanner.Handle(ctx, qrURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return // 签到已结束
+			}
+			failures++
+			retryable := autoqr.Retryable(err)
+			metrics.AutoQRRuns.Inc(mode, "failed")
+			log.Warn("[AutoQR] 扫描失败", "mode", mode, "err", err, "retryable", retryable, "failures", failures)
+			bus.Publish(events.AutoQRFailed, map[string]any{
+				"courseId": courseID, "signId": signID, "mode": mode, "error": err.Error(),
+				"retryable": retryable, "failures": failures, "steps": res.Steps,
+			})
+			switch {
+			case retryable && failures <= scanRetries:
+				schedule(time.Now().Add(scanRetryDelay))
+			case retryable:
+				schedule(sched.next(time.Now(), interval))
+			case errors.Is(err, autoqr.ErrNotInstalled):
+				log.Info("[AutoQR] 提示: 请安装 AutoHotkey（v1 或 v2，可用 autoqr_ahk_version 指定）并设置环境变量 AUTOHOTKEY_EXE，或手动按 Alt+A 截图框选生成的二维码图片以识别")
+			}
+			continue
+		}
+		metrics.AutoQRRuns.Inc(mode, "ok")
+		failures = 0
+		if res.Triggered {
+			at := sched.next(time.Now(), interval)
+			log.Info("[AutoQR] 已触发识别，等待 WS 回推(type=3)", "mode", mode, "png", res.PNG, "steps", res.Steps, "attempt", attempts, "next", at.Format("15:04:05.000"))
+			schedule(at)
+		}
+	}
+}
+
+// hasSign reports whether signID is still among the active signs.
+func hasSign(active []requests.ActiveSign, signID int) bool {
+	for _, a := range active {
+		if a.SignID == signID {
+			return true
+		}
+	}
+	return false
+}
+
+// isOwnResult reports whether a type=3 push is about this student. Without a profile
+// every result is treated as ours.
+func isOwnResult(res qrws.StudentResult, p *requests.StudentProfile) bool {
+	switch {
+	case p == nil:
+		return true
+	case p.StudentNumber != "" && res.StudentNumber != "":
+		return p.StudentNumber == res.StudentNumber
+	case p.Name != "":
+		return p.Name == res.Name
+	}
+	return true
+}
+
+// waitOwnResult waits up to d, or until a poll is forced, for this student's type=3 result.
+// The WS client only forwards our own results (Options.OwnResult).
+func waitOwnResult(results <-chan qrws.StudentResult, wake <-chan struct{}, d time.Duration) (qrws.StudentResult, bool) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case res := <-results:
+		return res, true
+	case <-t.C:
+	case <-wake:
+	}
+	return qrws.StudentResult{}, false
+}
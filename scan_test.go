@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qrws"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/requests"
+)
+
+func resultFrame(name, number string, rank int) string {
+	return fmt.Sprintf(`{"dir":"in","frame":[{"channel":"/attendance/1/2/qr","data":{"type":3,"student":{"id":%d,"name":%q,"studentNumber":%q,"rank":%d}}}]}`, rank, name, number, rank)
+}
+
+func TestOwnResultAfterForeignResults(t *testing.T) {
+	me := &requests.StudentProfile{Name: "测试同学", StudentNumber: "20260001"}
+	c := qrws.NewWithOptions(qrws.Options{
+		OwnResult: func(res qrws.StudentResult) bool { return isOwnResult(res, me) },
+	})
+	replay := func(frame string) {
+		t.Helper()
+		if _, err := c.Replay(strings.NewReader(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 其他同学的结果先到，且在主循环开始等待之前没有人读取 ResultCh
+	for i := 1; i <= 5; i++ {
+		replay(resultFrame(fmt.Sprintf("同学%d", i), fmt.Sprintf("2026010%d", i), i))
+	}
+	if _, ok := waitOwnResult(c.ResultCh, nil, 50*time.Millisecond); ok {
+		t.Fatal("a foreign result was taken as ours")
+	}
+	replay(resultFrame("同学6", "20260106", 6))
+	replay(resultFrame(me.Name, me.StudentNumber, 7))
+	replay(resultFrame("同学8", "20260108", 8))
+
+	res, ok := waitOwnResult(c.ResultCh, nil, time.Second)
+	if !ok {
+		t.Fatal("own result was dropped behind foreign results")
+	}
+	if res.StudentNumber != me.StudentNumber || res.Rank != 7 {
+		t.Fatalf("result = %+v", res)
+	}
+}
+
+func TestWaitOwnResultWokenEarly(t *testing.T) {
+	wake := make(chan struct{}, 1)
+	wake <- struct{}{}
+	start := time.Now()
+	if _, ok := waitOwnResult(make(chan qrws.StudentResult), wake, time.Minute); ok {
+		t.Fatal("got a result from an empty channel")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("forced poll did not end the wait (%v)", d)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/config"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/credstore"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/events"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/input"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/redact"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/requests"
+)
+
+// session holds the current openid and whether it is still accepted. The poller, the
+// periodic health check and whoever supplies a fresh openid (stdin) share it.
+type session struct {
+	cli   *requests.Client
+	store *credstore.Store
+	bus   *events.Bus
+
+	mu        sync.Mutex
+	openid    string
+	profile   *requests.StudentProfile
+	expired   bool
+	checkedAt time.Time
+	renewed   chan struct{} // 过期期间有效；新 openid 生效时关闭
+}
+
+func newSession(cli *requests.Client, store *credstore.Store, bus *events.Bus, openid string, profile *requests.StudentProfile) *session {
+	return &session{cli: cli, store: store, bus: bus, openid: openid, profile: profile, checkedAt: time.Now()}
+}
+
+func (s *session) OpenID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.openid
+}
+
+func (s *session) Profile() *requests.StudentProfile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profile
+}
+
+func (s *session) Expired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expired
+}
+
+// CheckedAt is when the openid was last confirmed valid.
+func (s *session) CheckedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkedAt
+}
+
+// markExpired switches to the expired state once and starts prompting for a new openid.
+func (s *session) markExpired(reason error) {
+	s.mu.Lock()
+	if s.expired {
+		s.mu.Unlock()
+		return
+	}
+	s.expired = true
+	renewed := make(chan struct{})
+	s.renewed = renewed
+	s.mu.Unlock()
+	log.Error("session expired: openid 已失效，轮询暂停；请输入新的 openid 或链接（WS 连接保持）", "err", reason)
+	s.bus.Publish(events.OpenIDExpired, map[string]any{"error": reason.Error()})
+	if s.store != nil {
+		if err := s.store.Clear(); err != nil {
+			log.Warn("删除失效凭据失败", "err", err)
+		}
+	}
+	go s.promptLoop(renewed)
+}
+
+// waitRenewed blocks until Renew accepts a new openid.
+func (s *session) waitRenewed() {
+	s.mu.Lock()
+	ch := s.renewed
+	s.mu.Unlock()
+	if ch != nil {
+		<-ch
+	}
+}
+
+// Renew validates a fresh openid and, if accepted, resumes the session.
+func (s *session) Renew(openid string) error {
+	redact.Add(redact.KindOpenID, openid)
+	profile, err := s.cli.GetStudentProfile(openid)
+	if err != nil {
+		return err
+	}
+	registerProfile(profile)
+	s.mu.Lock()
+	s.openid = openid
+	s.profile = profile
+	s.checkedAt = time.Now()
+	wasExpired := s.expired
+	s.expired = false
+	if s.renewed != nil {
+		close(s.renewed)
+		s.renewed = nil
+	}
+	s.mu.Unlock()
+	if s.store != nil {
+		if err := s.store.Save(openid); err != nil {
+			log.Warn("保存 openid 失败", "err", err)
+		}
+	}
+	if wasExpired {
+		log.Info("session renewed: 已使用新的 openid 恢复轮询", "name", profile.Name)
+		s.bus.Publish(events.OpenIDRenewed, map[string]any{"name": profile.Name})
+	}
+	return nil
+}
+
+// promptLoop takes openids from the shared stdin reader until the session is renewed.
+// 由其他途径续期时立即退出，不会残留阻塞在标准输入上的协程。
+func (s *session) promptLoop(renewed <-chan struct{}) {
+	lines := input.Lines()
+	for {
+		input.PromptOpenid()
+		select {
+		case <-renewed:
+			return
+		case text, ok := <-lines:
+			if !ok {
+				log.Warn("标准输入已关闭，无法再输入 openid")
+				return
+			}
+			id, err := input.ExtractOpenid(text)
+			if err != nil {
+				log.Warn("读取 openid 失败", "err", err)
+				continue
+			}
+			if err := s.Renew(id); err != nil {
+				log.Warn("新的 openid 无效，请重新输入", "err", err)
+				continue
+			}
+			return
+		}
+	}
+}
+
+// healthLoop periodically re-validates the openid via v2/students.
+func (s *session) healthLoop(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if s.Expired() {
+			continue
+		}
+		_, err := s.cli.GetStudentProfile(s.OpenID())
+		switch {
+		case err == nil:
+			s.mu.Lock()
+			s.checkedAt = time.Now()
+			s.mu.Unlock()
+			log.Debug("openid 健康检查通过")
+		case requests.IsUnauthorized(err):
+			s.markExpired(err)
+		default:
+			// 网络错误不判定为过期
+			log.Warn("openid 健康检查失败", "err", err)
+		}
+	}
+}
+
+// credentialStore builds the openid store from config; nil when disabled.
+func credentialStore(cfg *config.Config) *credstore.Store {
+	if cfg.CredentialFile == "" || cfg.CredentialFile == "none" {
+		return nil
+	}
+	store := &credstore.Store{Path: cfg.CredentialFile}
+	if cfg.CredentialEncrypt {
+		store.Passphrase = os.Getenv("WZJ_CRED_PASSPHRASE")
+		if store.Passphrase == "" {
+			store.Passphrase = input.GetPassphrase("credential passphrase: ")
+		}
+		if store.Passphrase == "" {
+			log.Warn("未提供口令，本次不读取/保存 openid 凭据")
+			return nil
+		}
+	}
+	return store
+}
+
+// acquireOpenid returns a validated openid and profile. A saved openid is reused until
+// GetStudentProfile reports it invalid (HTTP 401/403); only then the user is prompted.
+func acquireOpenid(cli *requests.Client, store *credstore.Store) (string, *requests.StudentProfile) {
+	if store != nil {
+		id, err := store.Load()
+		switch {
+		case err == nil:
+			redact.Add(redact.KindOpenID, id)
+			profile, err := cli.GetStudentProfile(id)
+			if err == nil {
+				log.Info("使用已保存的 openid", "file", store.Path)
+				registerProfile(profile)
+				return id, profile
+			}
+			if !requests.IsUnauthorized(err) {
+				// 网络等临时错误不代表凭据失效，保留文件
+				log.Error("your openid is invalid", "err", err)
+				os.Exit(1)
+			}
+			log.Warn("已保存的 openid 已失效，请重新输入", "err", err)
+			if err := store.Clear(); err != nil {
+				log.Warn("删除失效凭据失败", "err", err)
+			}
+		case errors.Is(err, credstore.ErrNotFound):
+		default:
+			log.Warn("读取已保存的 openid 失败", "err", err)
+		}
+	}
+
+	for {
+		id, err := input.GetOpenid()
+		if err != nil {
+			log.Warn("读取 openid 失败", "err", err)
+			continue
+		}
+		redact.Add(redact.KindOpenID, id)
+		profile, err := cli.GetStudentProfile(id)
+		if err != nil {
+			if requests.IsUnauthorized(err) {
+				log.Warn("openid 无效，请重新输入", "err", err)
+				continue
+			}
+			log.Error("your openid is invalid", "err", err)
+			os.Exit(1)
+		}
+		registerProfile(profile)
+		if store != nil {
+			if err := store.Save(id); err != nil {
+				log.Warn("保存 openid 失败", "err", err)
+			} else {
+				log.Info("openid 已保存，下次启动自动使用", "file", store.Path)
+			}
+		}
+		return id, profile
+	}
+}
+
+func registerProfile(p *requests.StudentProfile) {
+	redact.Add(redact.KindName, p.Name)
+	redact.Add(redact.KindStudentNumber, p.StudentNumber)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/qrws"
+	"github.com/zwh20041221/wzj-assistant-autoCkeckin/internal/requests"
+)
+
+// pollState records what the polling loop last saw, for the status API.
+type pollState struct {
+	mu       sync.Mutex
+	lastPoll time.Time
+	lastErr  string
+	active   []requests.ActiveSign
+}
+
+// record stores the result of one ActiveSigns call; on error the last list is kept.
+func (p *pollState) record(active []requests.ActiveSign, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastPoll = time.Now()
+	if err != nil {
+		p.lastErr = err.Error()
+		return
+	}
+	p.lastErr = ""
+	p.active = append([]requests.ActiveSign(nil), active...)
+}
+
+// statusReport is the body of GET /status.
+type statusReport struct {
+	Time            time.Time             `json:"time"`
+	Name            string                `json:"name,omitempty"`
+	OpenIDValid     bool                  `json:"openidValid"`
+	OpenIDCheckedAt time.Time             `json:"openidCheckedAt"`
+	WS              qrws.Status           `json:"ws"`
+	Paused          bool                  `json:"paused"`
+	AutoQRMode      string                `json:"autoqrMode"`
+	Debug           bool                  `json:"debug"`
+	LastPoll        time.Time             `json:"lastPoll"`
+	LastPollError   string                `json:"lastPollError,omitempty"`
+	ActiveSigns     []requests.ActiveSign `json:"activeSigns"`
+	QRTimelines     []qrws.SignTimeline   `json:"qrTimelines"`     // 最近几个签到的二维码刷新记录
+	UnknownMessages []qrws.Unknown        `json:"unknownMessages"` // 本次运行中未识别的 WS 消息种类
+}
+
+func buildStatus(sess *session, ws *qrws.Client, poll *pollState, ctl *controller) statusReport {
+	st := statusReport{
+		Time:            time.Now(),
+		OpenIDValid:     !sess.Expired(),
+		OpenIDCheckedAt: sess.CheckedAt(),
+		WS:              ws.Status(),
+		QRTimelines:     ws.QRTimelines(),
+		UnknownMessages: ws.UnknownMessages(),
+		Paused:          ctl.Paused(),
+		AutoQRMode:      ctl.Mode(),
+		Debug:           ctl.Debug(),
+	}
+	if p := sess.Profile(); p != nil {
+		st.Name = p.Name
+	}
+	poll.mu.Lock()
+	st.LastPoll = poll.lastPoll
+	st.LastPollError = poll.lastErr
+	st.ActiveSigns = append([]requests.ActiveSign{}, poll.active...)
+	poll.mu.Unlock()
+	return st
+}
+
+// sessionHealth backs /healthz: an expired openid means the tool cannot sign in.
+func sessionHealth(sess *session) func() error {
+	return func() error {
+		if sess.Expired() {
+			return errors.New("openid expired")
+		}
+		return nil
+	}
+}